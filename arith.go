@@ -0,0 +1,177 @@
+package stagparser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"text/scanner"
+	"unicode"
+)
+
+// parseExpr parses an arithmetic expression over numeric literals.
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = "-" factor | "(" expr ")" | int | float
+func (p *parser) parseExpr() (interface{}, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.skipWhitespace()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		pos := p.s.Pos()
+		_ = p.s.Next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left, err = p.calc(op, pos, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseTerm() (interface{}, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.skipWhitespace()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		pos := p.s.Pos()
+		_ = p.s.Next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left, err = p.calc(op, pos, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseFactor() (interface{}, error) {
+	switch p.skipWhitespace() {
+	case '-':
+		pos := p.s.Pos()
+		_ = p.s.Next()
+		if unicode.IsDigit(p.s.Peek()) {
+			// a negative literal, so that math.MinInt64 can be written
+			return p.parseNumber("-", pos)
+		}
+		v, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return p.calc('-', pos, int64(0), v)
+	case '(':
+		_ = p.s.Next()
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipWhitespace()
+		pos := p.s.Pos()
+		if next := p.s.Next(); next != ')' {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf(") expected but got %s", string(next)))
+		}
+		return v, nil
+	}
+	return p.parseNumber("", p.s.Pos())
+}
+
+// parseNumber parses a numeric literal with a sign at pos.
+func (p *parser) parseNumber(sign string, pos scanner.Position) (interface{}, error) {
+	switch p.s.Scan() {
+	case scanner.Int:
+		v, err := parseInt(sign + p.s.TokenText())
+		if err != nil {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid integer: %s%s", sign, p.s.TokenText()))
+		}
+		return v, nil
+	case scanner.Float:
+		v, err := strconv.ParseFloat(sign+p.s.TokenText(), 64)
+		if err != nil {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid float: %s%s", sign, p.s.TokenText()))
+		}
+		return v, nil
+	}
+	return nil, p.parseError(fmt.Sprintf("invalid value: '%s'", p.s.TokenText()))
+}
+
+// calc applies op at pos to given operands. As in Go, the result is an int64
+// if both operands are int64, a float64 otherwise. Unlike Go, calc returns
+// an error if an int64 operation overflows.
+func (p *parser) calc(op rune, pos scanner.Position, left, right interface{}) (interface{}, error) {
+	l, lok := left.(int64)
+	r, rok := right.(int64)
+	if lok && rok {
+		if op == '/' && r == 0 {
+			return nil, p.parseErrorAt(pos, "division by zero")
+		}
+		v, ok := calcInt(op, l, r)
+		if !ok {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("integer overflow: %d %c %d", l, op, r))
+		}
+		return v, nil
+	}
+	lf, rf := toFloat(left), toFloat(right)
+	switch op {
+	case '+':
+		return lf + rf, nil
+	case '-':
+		return lf - rf, nil
+	case '*':
+		return lf * rf, nil
+	}
+	if rf == 0 {
+		return nil, p.parseErrorAt(pos, "division by zero")
+	}
+	return lf / rf, nil
+}
+
+// calcInt applies op to given operands. calcInt returns false if the result
+// overflows an int64.
+func calcInt(op rune, l, r int64) (int64, bool) {
+	switch op {
+	case '+':
+		if (r > 0 && l > math.MaxInt64-r) || (r < 0 && l < math.MinInt64-r) {
+			return 0, false
+		}
+		return l + r, true
+	case '-':
+		if (r < 0 && l > math.MaxInt64+r) || (r > 0 && l < math.MinInt64+r) {
+			return 0, false
+		}
+		return l - r, true
+	case '*':
+		if l == 0 || r == 0 {
+			return 0, true
+		}
+		v := l * r
+		if v/r != l || (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+			return 0, false
+		}
+		return v, true
+	}
+	if l == math.MinInt64 && r == -1 {
+		return 0, false
+	}
+	return l / r, true
+}
+
+func toFloat(v interface{}) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
@@ -0,0 +1,114 @@
+package stagparser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// BindTag is a struct tag name used by Bind.
+const BindTag = "stagparser"
+
+// Bind sets attribute values of given definitions into fields of the struct
+// pointed by optsPtr. Fields are mapped by the BindTag tag:
+//
+//   - `stagparser:"min"`: an attribute named 'min' of any definition
+//   - `stagparser:"length.min"`: an attribute named 'min' of the 'length' definition
+//   - `stagparser:"required"`: on a bool field, true if a definition named 'required' exists
+//
+// Fields without the tag and attributes that do not exist are left untouched.
+func Bind(defs []Definition, optsPtr interface{}) error {
+	rv := reflect.ValueOf(optsPtr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("a non-nil pointer to a struct expected but got %T", optsPtr)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		key := f.Tag.Get(BindTag)
+		if len(key) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		if !fv.CanSet() {
+			return fmt.Errorf("%s.%s: field is not settable", rt.Name(), f.Name)
+		}
+		value, ok := lookupBindValue(defs, key)
+		if !ok {
+			if fv.Kind() == reflect.Bool && findDefinition(defs, key) != nil {
+				fv.SetBool(true)
+			}
+			continue
+		}
+		if err := setBindValue(fv, value); err != nil {
+			return fmt.Errorf("%s.%s: %w", rt.Name(), f.Name, err)
+		}
+	}
+	return nil
+}
+
+func findDefinition(defs []Definition, name string) Definition {
+	for _, def := range defs {
+		if def.Name() == name {
+			return def
+		}
+	}
+	return nil
+}
+
+func lookupBindValue(defs []Definition, key string) (interface{}, bool) {
+	if i := strings.IndexByte(key, '.'); i > -1 {
+		def := findDefinition(defs, key[:i])
+		if def == nil {
+			return nil, false
+		}
+		return def.Attribute(key[i+1:])
+	}
+	for _, def := range defs {
+		if v, ok := def.Attribute(key); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func setBindValue(fv reflect.Value, value interface{}) error {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v, ok := value.(int64); ok && !fv.OverflowInt(v) {
+			fv.SetInt(v)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v, ok := value.(int64); ok && v >= 0 && !fv.OverflowUint(uint64(v)) {
+			fv.SetUint(uint64(v))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch v := value.(type) {
+		case float64:
+			fv.SetFloat(v)
+			return nil
+		case int64:
+			fv.SetFloat(float64(v))
+			return nil
+		}
+	case reflect.Slice:
+		if vs, ok := value.([]interface{}); ok {
+			s := reflect.MakeSlice(fv.Type(), len(vs), len(vs))
+			for i, v := range vs {
+				if err := setBindValue(s.Index(i), v); err != nil {
+					return err
+				}
+			}
+			fv.Set(s)
+			return nil
+		}
+	}
+	if value != nil && reflect.TypeOf(value).AssignableTo(fv.Type()) {
+		fv.Set(reflect.ValueOf(value))
+		return nil
+	}
+	return fmt.Errorf("can not set %v(%T) to %s", value, value, fv.Type())
+}
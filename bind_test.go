@@ -0,0 +1,50 @@
+package stagparser_test
+
+import (
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+type lengthOptions struct {
+	Min      int      `stagparser:"length.min"`
+	Max      int      `stagparser:"max"`
+	Ratio    float64  `stagparser:"ratio"`
+	In       []string `stagparser:"in"`
+	Required bool     `stagparser:"required"`
+	Unused   string   `stagparser:"unused"`
+}
+
+func TestBind(t *testing.T) {
+	defs, err := ParseTag("required,length(min=1,max=10),ratio=2,in=[a, b]", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	opts := &lengthOptions{Unused: "default"}
+	if err := Bind(defs, opts); err != nil {
+		t.Fatalf("bind failed: %s", err.Error())
+	}
+	if opts.Min != 1 || opts.Max != 10 {
+		t.Fatalf("Min and Max should be 1 and 10 but got %d and %d", opts.Min, opts.Max)
+	}
+	if opts.Ratio != 2 {
+		t.Fatalf("Ratio should be 2 but got %f", opts.Ratio)
+	}
+	if len(opts.In) != 2 || opts.In[0] != "a" || opts.In[1] != "b" {
+		t.Fatalf("In should be [a b] but got %v", opts.In)
+	}
+	if !opts.Required {
+		t.Fatalf("Required should be true")
+	}
+	if opts.Unused != "default" {
+		t.Fatalf("Unused should be untouched but got %s", opts.Unused)
+	}
+
+	defs, _ = ParseTag("length(min='a')", "t")
+	if err := Bind(defs, &lengthOptions{}); err == nil {
+		t.Fatalf("binding a string to an int field should be an error")
+	}
+	if err := Bind(defs, lengthOptions{}); err == nil {
+		t.Fatalf("binding to a non-pointer should be an error")
+	}
+}
@@ -0,0 +1,60 @@
+package stagparser
+
+import (
+	"reflect"
+	"sync"
+)
+
+type structCacheKey struct {
+	typ reflect.Type
+	tag string
+}
+
+// Cache caches results of ParseStruct per a struct type and a tag name.
+// The zero value is ready to use. Cache is safe for concurrent use.
+type Cache struct {
+	m sync.Map
+}
+
+// ParseStruct is like the package level ParseStruct, but returns a cached
+// result if exists.
+// The returned map and slices are copies, but definitions are shared
+// between callers, so they must not be modified.
+func (c *Cache) ParseStruct(obj interface{}, tag string) (map[string][]Definition, error) {
+	cached, err := c.load(obj, tag)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]Definition, len(cached))
+	for field, defs := range cached {
+		result[field] = append([]Definition(nil), defs...)
+	}
+	return result, nil
+}
+
+func (c *Cache) load(obj interface{}, tag string) (map[string][]Definition, error) {
+	typ := reflect.TypeOf(obj)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	key := structCacheKey{typ: typ, tag: tag}
+	if v, ok := c.m.Load(key); ok {
+		return v.(map[string][]Definition), nil
+	}
+	result, err := ParseStruct(obj, tag)
+	if err != nil {
+		return nil, err
+	}
+	v, _ := c.m.LoadOrStore(key, result)
+	return v.(map[string][]Definition), nil
+}
+
+var structCache Cache
+
+// ParseStructCached is like ParseStruct, but caches results per a struct type
+// and a tag name. ParseStructCached is safe for concurrent use.
+// Returned maps and definitions are shared between callers, so
+// they must not be modified.
+func ParseStructCached(obj interface{}, tag string) (map[string][]Definition, error) {
+	return structCache.load(obj, tag)
+}
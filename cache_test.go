@@ -0,0 +1,109 @@
+package stagparser_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func TestParseStructCached(t *testing.T) {
+	fresh, err := ParseStruct(&StructA{}, "t1")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	cached, err := ParseStructCached(&StructA{}, "t1")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual(fresh, cached) {
+		t.Fatalf("cached result should be equal to a fresh result")
+	}
+	again, _ := ParseStructCached(StructA{}, "t1")
+	if reflect.ValueOf(again).Pointer() != reflect.ValueOf(cached).Pointer() {
+		t.Fatalf("result should be cached")
+	}
+}
+
+func TestParseStructCachedConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				result, err := ParseStructCached(&StructMerged{}, "validate")
+				if err != nil || len(result) != 2 {
+					t.Errorf("2 fields should be parsed but got %d, %v", len(result), err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCache(t *testing.T) {
+	var cache Cache
+	fresh, err := ParseStruct(&StructA{}, "t1")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	cached, err := cache.ParseStruct(&StructA{}, "t1")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if !reflect.DeepEqual(fresh, cached) {
+		t.Fatalf("cached result should be equal to a fresh result")
+	}
+	delete(cached, "f1")
+	cached["f2"][0] = nil
+	again, _ := cache.ParseStruct(StructA{}, "t1")
+	if !reflect.DeepEqual(fresh, again) {
+		t.Fatalf("modifying a result should not affect the cache")
+	}
+	if again["f3"][0] != cached["f3"][0] {
+		t.Fatalf("definitions should be cached")
+	}
+	if _, err := cache.ParseStruct(&StructA{}, "t2"); err == nil {
+		t.Fatalf("an invalid tag should be an error")
+	}
+}
+
+func TestCacheConcurrently(t *testing.T) {
+	var cache Cache
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var obj interface{} = &StructMerged{}
+				if (i+j)%2 == 0 {
+					obj = StructA{}
+				}
+				result, err := cache.ParseStruct(obj, "validate")
+				if err != nil {
+					t.Errorf("parse failed: %s", err.Error())
+					return
+				}
+				result["x"] = nil
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkParseStruct(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseStruct(&StructA{}, "t1")
+	}
+}
+
+func BenchmarkCacheParseStruct(b *testing.B) {
+	var cache Cache
+	for i := 0; i < b.N; i++ {
+		_, _ = cache.ParseStruct(&StructA{}, "t1")
+	}
+}
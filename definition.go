@@ -1,5 +1,11 @@
 package stagparser
 
+import (
+	"fmt"
+	"strings"
+	"text/scanner"
+)
+
 // Definition is a struct tag value element.
 type Definition interface {
 	// Name is a name of the definition
@@ -8,14 +14,78 @@ type Definition interface {
 	Attributes() map[string]interface{}
 	// Attribute returns an attribute value and true if an attribute exists
 	Attribute(name string) (interface{}, bool)
+	// Description is a text of a comment preceding the definition.
+	// This requires WithDescriptionComments
+	Description() string
+	// HasParens returns true if the definition is written with parentheses like required()
+	HasParens() bool
+	// String returns a canonical tag value of the definition
+	String() string
+	// IntAttribute returns an int64 attribute value and true if an attribute
+	// exists and is an int64
+	IntAttribute(name string) (int64, bool)
+	// FloatAttribute returns a float64 attribute value and true if an attribute
+	// exists and is a float64 or an int64
+	FloatAttribute(name string) (float64, bool)
+	// StringAttribute returns a string attribute value and true if an attribute
+	// exists and is a string
+	StringAttribute(name string) (string, bool)
+	// BoolAttribute returns a bool attribute value and true if an attribute
+	// exists and is a bool
+	BoolAttribute(name string) (bool, bool)
+	// ArrayAttribute returns an array attribute value and true if an attribute
+	// exists and is an array
+	ArrayAttribute(name string) ([]interface{}, bool)
+	// AttributeTyped returns an attribute value with its kind and true if an
+	// attribute exists. Identifier kinds and raw texts require WithTypedValues
+	AttributeTyped(name string) (TypedValue, bool)
+}
+
+// KV is a key-value pair.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// Position is a position in a tag value.
+type Position struct {
+	// Line is a line number starting at 1
+	Line int
+	// Column is a column number starting at 1
+	Column int
+	// Offset is a byte offset starting at 0
+	Offset int
+}
+
+func newPosition(pos scanner.Position) Position {
+	return Position{Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+}
+
+// PositionedDefinition is a Definition with source positions.
+// Definitions returned by the parser implement PositionedDefinition.
+type PositionedDefinition interface {
+	Definition
+	// Position is a position of the definition name
+	Position() Position
+	// AttributePosition returns a position of an attribute value and true
+	// if the position is known
+	AttributePosition(name string) (Position, bool)
 }
 
 type definition struct {
-	name       string
-	attributes map[string]interface{}
+	name        string
+	attributes  map[string]interface{}
+	description string
+	parens      bool
+	typed       map[string]TypedValue
+	pos         Position
+	positions   map[string]Position
+	// simple is true if the definition is parsed by parseSimple. Positions
+	// of simple definitions are computed on demand
+	simple bool
 }
 
-func newDefinition(name string, attributes map[string]interface{}) Definition {
+func newDefinition(name string, attributes map[string]interface{}) *definition {
 	return &definition{
 		name:       name,
 		attributes: attributes,
@@ -34,3 +104,285 @@ func (d *definition) Attribute(name string) (interface{}, bool) {
 	v, ok := d.attributes[name]
 	return v, ok
 }
+
+func (d *definition) Description() string {
+	return d.description
+}
+
+func (d *definition) HasParens() bool {
+	return d.parens
+}
+
+func (d *definition) String() string {
+	s, err := marshalDefinition(d)
+	if err != nil {
+		return fmt.Sprintf("%s%v", d.name, d.attributes)
+	}
+	return s
+}
+
+func (d *definition) IntAttribute(name string) (int64, bool) {
+	v, ok := d.attributes[name].(int64)
+	return v, ok
+}
+
+func (d *definition) FloatAttribute(name string) (float64, bool) {
+	switch v := d.attributes[name].(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func (d *definition) StringAttribute(name string) (string, bool) {
+	v, ok := d.attributes[name].(string)
+	return v, ok
+}
+
+func (d *definition) BoolAttribute(name string) (bool, bool) {
+	v, ok := d.attributes[name].(bool)
+	return v, ok
+}
+
+func (d *definition) ArrayAttribute(name string) ([]interface{}, bool) {
+	v, ok := d.attributes[name].([]interface{})
+	return v, ok
+}
+
+func (d *definition) AttributeTyped(name string) (TypedValue, bool) {
+	if tv, ok := d.typed[name]; ok {
+		return tv, true
+	}
+	v, ok := d.attributes[name]
+	if !ok {
+		return TypedValue{}, false
+	}
+	return TypedValue{Kind: valueKind(v, ""), Value: v}, true
+}
+
+func (d *definition) Position() Position {
+	return d.pos
+}
+
+func (d *definition) AttributePosition(name string) (Position, bool) {
+	if d.simple && name == d.name && len(d.attributes) != 0 {
+		// name=int
+		return Position{Line: 1, Column: len(name) + 2, Offset: len(name) + 1}, true
+	}
+	pos, ok := d.positions[name]
+	return pos, ok
+}
+
+// AttributePairs returns an array attribute of d that consists of
+// [key, value] arrays like [[Accept, 'text/html'], [Accept, 'application/json']]
+// as key-value pairs in order and true if an attribute exists and is
+// an array of pairs.
+func AttributePairs(d Definition, name string) ([]KV, bool) {
+	v, _ := d.Attribute(name)
+	values, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	result := make([]KV, 0, len(values))
+	for _, v := range values {
+		pair, ok := v.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, false
+		}
+		key, ok := pair[0].(string)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, KV{Key: key, Value: pair[1]})
+	}
+	return result, true
+}
+
+// AttributeAsStruct parses a string attribute of d like
+// 'Name:required;Age:min=0' as tag values of struct fields. A map key is
+// a field name and tag is used as a source name of errors.
+func AttributeAsStruct(d Definition, name, tag string) (map[string][]Definition, error) {
+	v, err := attributeE(d, name, "string")
+	if err != nil {
+		return nil, err
+	}
+	s := v.(string)
+	result := map[string][]Definition{}
+	for start := 0; start < len(s); {
+		end := findSeparator(s, start, ';')
+		field := strings.TrimSpace(s[start:end])
+		start = end + 1
+		if len(field) == 0 {
+			continue
+		}
+		i := strings.IndexByte(field, ':')
+		if i < 1 {
+			return nil, fmt.Errorf("attribute '%s': invalid field: %s", name, field)
+		}
+		fieldName := strings.TrimSpace(field[:i])
+		defs, err := ParseTag(field[i+1:], tag+"."+fieldName)
+		if err != nil {
+			return nil, err
+		}
+		result[fieldName] = defs
+	}
+	return result, nil
+}
+
+// AttributeIntE returns an int64 attribute value of d or an error if
+// an attribute does not exist or is not an int64.
+func AttributeIntE(d Definition, name string) (int64, error) {
+	v, err := attributeE(d, name, "int")
+	if err != nil {
+		return 0, err
+	}
+	return v.(int64), nil
+}
+
+// AttributeFloatE returns a float64 attribute value of d or an error if
+// an attribute does not exist or is not a float64. An int64 value is
+// converted into a float64 like FloatAttribute.
+func AttributeFloatE(d Definition, name string) (float64, error) {
+	if v, ok := d.Attribute(name); ok {
+		if i, isInt := v.(int64); isInt {
+			return float64(i), nil
+		}
+	}
+	v, err := attributeE(d, name, "float")
+	if err != nil {
+		return 0, err
+	}
+	return v.(float64), nil
+}
+
+// AttributeStringE returns a string attribute value of d or an error if
+// an attribute does not exist or is not a string.
+func AttributeStringE(d Definition, name string) (string, error) {
+	v, err := attributeE(d, name, "string")
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// AttributeBoolE returns a bool attribute value of d or an error if
+// an attribute does not exist or is not a bool.
+func AttributeBoolE(d Definition, name string) (bool, error) {
+	v, err := attributeE(d, name, "bool")
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+func attributeE(d Definition, name string, want string) (interface{}, error) {
+	v, ok := d.Attribute(name)
+	if !ok {
+		return nil, fmt.Errorf("attribute '%s' missing", name)
+	}
+	if k := kindName(v); k != want {
+		return nil, fmt.Errorf("attribute '%s' is %s, want %s", name, k, want)
+	}
+	return v, nil
+}
+
+func kindName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Len returns the number of attributes of d.
+func Len(d Definition) int {
+	return len(d.Attributes())
+}
+
+// IsFlag returns true if d has no attributes like required.
+func IsFlag(d Definition) bool {
+	return Len(d) == 0
+}
+
+// ParseEnum returns a string attribute value as T if the value is one of valid.
+// ParseEnum returns the zero value and false if an attribute does not exist,
+// is not a string or is not valid.
+func ParseEnum[T ~string](d Definition, name string, valid []T) (T, bool) {
+	var zero T
+	v, ok := d.Attribute(name)
+	if !ok {
+		return zero, false
+	}
+	s, ok := v.(string)
+	if !ok {
+		return zero, false
+	}
+	for _, e := range valid {
+		if string(e) == s {
+			return e, true
+		}
+	}
+	return zero, false
+}
+
+// Definitions is a list of definitions.
+type Definitions []Definition
+
+// Group returns definitions named name in order.
+func (d Definitions) Group(name string) DefinitionGroup {
+	var result DefinitionGroup
+	for _, def := range d {
+		if def.Name() == name {
+			result = append(result, def)
+		}
+	}
+	return result
+}
+
+// DefinitionGroup is a list of definitions sharing a name.
+type DefinitionGroup []Definition
+
+// First returns the first definition or nil if the group is empty.
+func (g DefinitionGroup) First() Definition {
+	if len(g) == 0 {
+		return nil
+	}
+	return g[0]
+}
+
+// Last returns the last definition or nil if the group is empty.
+func (g DefinitionGroup) Last() Definition {
+	if len(g) == 0 {
+		return nil
+	}
+	return g[len(g)-1]
+}
+
+// All returns all definitions in the group.
+func (g DefinitionGroup) All() []Definition {
+	return g
+}
+
+// MergedAttributes returns attributes of all definitions merged into a map.
+// Attributes of later definitions take precedence.
+func (g DefinitionGroup) MergedAttributes() map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, def := range g {
+		for key, value := range def.Attributes() {
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,275 @@
+package stagparser_test
+
+import (
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func TestDefinitionLen(t *testing.T) {
+	defs, err := ParseTag("required,max=10,length(min=1, max=10)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("tag should be parsed into 3 definitions but %d", len(defs))
+	}
+	for i, expected := range []int{0, 1, 2} {
+		if Len(defs[i]) != expected {
+			t.Fatalf("'%s' should have %d attributes but got %d", defs[i].Name(), expected, Len(defs[i]))
+		}
+	}
+	if !IsFlag(defs[0]) {
+		t.Fatalf("'required' should be a flag")
+	}
+	if IsFlag(defs[1]) || IsFlag(defs[2]) {
+		t.Fatalf("'max' and 'length' should not be flags")
+	}
+}
+
+func TestDefinitionHasParens(t *testing.T) {
+	defs, err := ParseTag("required,required(),max=10,max(max=10)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for i, expected := range []bool{false, true, false, true} {
+		if defs[i].HasParens() != expected {
+			t.Fatalf("HasParens of definition %d should be %v", i, expected)
+		}
+	}
+	if Len(defs[1]) != 0 {
+		t.Fatalf("'required()' should not have attributes")
+	}
+}
+
+func TestDefinitionAttributeE(t *testing.T) {
+	defs, err := ParseTagWithOptions("length(min=1, ratio=0.5, name=abc, strict, list=[1])", "t", WithFlagArgs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	length := defs[0]
+	if v, err := AttributeIntE(length, "min"); err != nil || v != 1 {
+		t.Fatalf("min attribute should be 1 but got %v, %v", v, err)
+	}
+	if v, err := AttributeFloatE(length, "ratio"); err != nil || v != 0.5 {
+		t.Fatalf("ratio attribute should be 0.5 but got %v, %v", v, err)
+	}
+	if v, err := AttributeFloatE(length, "min"); err != nil || v != 1.0 {
+		t.Fatalf("AttributeFloatE should accept int values but got %v, %v", v, err)
+	}
+	if v, err := AttributeStringE(length, "name"); err != nil || v != "abc" {
+		t.Fatalf("name attribute should be abc but got %v, %v", v, err)
+	}
+	if v, err := AttributeBoolE(length, "strict"); err != nil || !v {
+		t.Fatalf("strict attribute should be true but got %v, %v", v, err)
+	}
+
+	for _, c := range []struct {
+		fn       func(string) error
+		name     string
+		expected string
+	}{
+		{func(n string) error { _, err := AttributeIntE(length, n); return err }, "max", "attribute 'max' missing"},
+		{func(n string) error { _, err := AttributeIntE(length, n); return err }, "name", "attribute 'name' is string, want int"},
+		{func(n string) error { _, err := AttributeFloatE(length, n); return err }, "name", "attribute 'name' is string, want float"},
+		{func(n string) error { _, err := AttributeStringE(length, n); return err }, "list", "attribute 'list' is array, want string"},
+		{func(n string) error { _, err := AttributeBoolE(length, n); return err }, "ratio", "attribute 'ratio' is float, want bool"},
+	} {
+		err := c.fn(c.name)
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("error should be %q but got %v", c.expected, err)
+		}
+	}
+}
+
+func TestDefinitionTypedAttributes(t *testing.T) {
+	defs, err := ParseTag("length(min=1,ratio=0.5,name=abc,strict=true,list=[1,2])", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	d := defs[0]
+	if v, ok := d.IntAttribute("min"); !ok || v != 1 {
+		t.Fatalf("min attribute should be 1 but got %v, %v", v, ok)
+	}
+	if v, ok := d.FloatAttribute("ratio"); !ok || v != 0.5 {
+		t.Fatalf("ratio attribute should be 0.5 but got %v, %v", v, ok)
+	}
+	if v, ok := d.FloatAttribute("min"); !ok || v != 1.0 {
+		t.Fatalf("min attribute should be widened to 1.0 but got %v, %v", v, ok)
+	}
+	if v, ok := d.StringAttribute("name"); !ok || v != "abc" {
+		t.Fatalf("name attribute should be abc but got %v, %v", v, ok)
+	}
+	if v, ok := d.BoolAttribute("strict"); !ok || !v {
+		t.Fatalf("strict attribute should be true but got %v, %v", v, ok)
+	}
+	if v, ok := d.ArrayAttribute("list"); !ok || len(v) != 2 || v[0] != int64(1) {
+		t.Fatalf("list attribute should be [1 2] but got %v, %v", v, ok)
+	}
+
+	for _, name := range []string{"missing", "ratio"} {
+		if v, ok := d.IntAttribute(name); ok || v != 0 {
+			t.Fatalf("IntAttribute(%s) should fail but got %v", name, v)
+		}
+	}
+	for _, name := range []string{"missing", "name"} {
+		if v, ok := d.FloatAttribute(name); ok || v != 0 {
+			t.Fatalf("FloatAttribute(%s) should fail but got %v", name, v)
+		}
+	}
+	for _, name := range []string{"missing", "min"} {
+		if v, ok := d.StringAttribute(name); ok || v != "" {
+			t.Fatalf("StringAttribute(%s) should fail but got %v", name, v)
+		}
+	}
+	for _, name := range []string{"missing", "name"} {
+		if v, ok := d.BoolAttribute(name); ok || v {
+			t.Fatalf("BoolAttribute(%s) should fail but got %v", name, v)
+		}
+	}
+	for _, name := range []string{"missing", "min"} {
+		if v, ok := d.ArrayAttribute(name); ok || v != nil {
+			t.Fatalf("ArrayAttribute(%s) should fail but got %v", name, v)
+		}
+	}
+}
+
+func TestDefinitionAttributeAsStruct(t *testing.T) {
+	defs, err := ParseTag("nested(fields='Name:required,length(min=1, max=10); Age:min=0;Tags:in(v=[\"a;b\"])', n=1)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	fields, err := AttributeAsStruct(defs[0], "fields", "Nested")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(fields) != 3 {
+		t.Fatalf("3 fields should be parsed but got %v", fields)
+	}
+	if d := fields["Name"]; len(d) != 2 || d[0].Name() != "required" || d[1].Name() != "length" {
+		t.Fatalf("unexpected Name: %v", d)
+	}
+	if v, ok := fields["Age"][0].IntAttribute("min"); !ok || v != 0 {
+		t.Fatalf("unexpected Age: %v", fields["Age"])
+	}
+	if v, _ := fields["Tags"][0].ArrayAttribute("v"); len(v) != 1 || v[0] != "a;b" {
+		t.Fatalf("unexpected Tags: %v", fields["Tags"])
+	}
+
+	if _, err := AttributeAsStruct(defs[0], "n", "Nested"); err == nil {
+		t.Fatalf("a non-string attribute should be an error")
+	}
+	defs, _ = ParseTag("nested(a='Name', b='Name:max=(')", "t")
+	if _, err := AttributeAsStruct(defs[0], "a", "Nested"); err == nil {
+		t.Fatalf("a missing field name should be an error")
+	}
+	_, err = AttributeAsStruct(defs[0], "b", "Nested")
+	if perr, ok := err.(ParseError); !ok || perr.Source() != "Nested.Name" {
+		t.Fatalf("error should be a ParseError of Nested.Name but got %v", err)
+	}
+}
+
+func TestDefinitionAttributeTyped(t *testing.T) {
+	defs, err := ParseTagWithOptions("x=foo,f(s='foo', i=0x10, b=true, l=[1, 2], o={a=1}, n=null)", "t", WithTypedValues())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if tv, ok := defs[0].AttributeTyped("x"); !ok || tv.Kind != KindIdent || tv.Value != "foo" || tv.Raw != "foo" {
+		t.Fatalf("x should be an identifier but got %#v", tv)
+	}
+	for name, expected := range map[string]TypedValue{
+		"s": {Kind: KindString, Value: "foo", Raw: "'foo'"},
+		"i": {Kind: KindInt, Value: int64(16), Raw: "0x10"},
+		"b": {Kind: KindBool, Value: true, Raw: "true"},
+		"n": {Kind: KindNull, Value: nil, Raw: "null"},
+	} {
+		if tv, ok := defs[1].AttributeTyped(name); !ok || tv != expected {
+			t.Fatalf("%s should be %#v but got %#v", name, expected, tv)
+		}
+	}
+	if tv, _ := defs[1].AttributeTyped("l"); tv.Kind != KindArray || tv.Raw != "[1, 2]" {
+		t.Fatalf("l should be an array but got %#v", tv)
+	}
+	if tv, _ := defs[1].AttributeTyped("o"); tv.Kind != KindObject || tv.Raw != "{a=1}" || tv.Kind.String() != "object" {
+		t.Fatalf("o should be an object but got %#v", tv)
+	}
+	if _, ok := defs[1].AttributeTyped("missing"); ok {
+		t.Fatalf("a missing attribute should not exist")
+	}
+
+	defs, _ = ParseTag("x=foo,y='foo'", "t")
+	for _, def := range defs {
+		if tv, ok := def.AttributeTyped(def.Name()); !ok || tv.Kind != KindString || tv.Raw != "" {
+			t.Fatalf("%s should be a string without a raw text but got %#v", def.Name(), tv)
+		}
+	}
+}
+
+type color string
+
+const (
+	red   color = "red"
+	green color = "green"
+)
+
+func TestParseEnum(t *testing.T) {
+	defs, err := ParseTag("style(fg=red, bg=blue, size=1)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	valid := []color{red, green}
+	if v, ok := ParseEnum(defs[0], "fg", valid); !ok || v != red {
+		t.Fatalf("fg attribute should be red but got %v, %v", v, ok)
+	}
+	for _, name := range []string{"bg", "size", "unknown"} {
+		if v, ok := ParseEnum(defs[0], name, valid); ok || v != "" {
+			t.Fatalf("%s attribute should be invalid but got %v, %v", name, v, ok)
+		}
+	}
+}
+
+func TestDefinitionsGroup(t *testing.T) {
+	defs, err := ParseTag("length(min=1, max=10),required,length(max=5, strict=true)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	group := Definitions(defs).Group("length")
+	if all := group.All(); len(all) != 2 || all[0] != defs[0] || all[1] != defs[2] {
+		t.Fatalf("group should have 2 definitions but got %v", all)
+	}
+	if group.First() != defs[0] || group.Last() != defs[2] {
+		t.Fatalf("unexpected first and last: %v, %v", group.First(), group.Last())
+	}
+	merged := group.MergedAttributes()
+	if len(merged) != 3 || merged["min"] != int64(1) || merged["max"] != int64(5) || merged["strict"] != true {
+		t.Fatalf("unexpected merged attributes: %v", merged)
+	}
+
+	empty := Definitions(defs).Group("missing")
+	if empty.First() != nil || empty.Last() != nil || len(empty.All()) != 0 || len(empty.MergedAttributes()) != 0 {
+		t.Fatalf("an empty group should have nothing")
+	}
+}
+
+func TestDefinitionAttributePairs(t *testing.T) {
+	defs, err := ParseTag("http(headers=[[Accept, 'text/html'], [Accept, 'application/json'], [Retry, 3]], "+
+		"bad=[[a, 1, 2]], badkey=[[1, 2]], flat=[a, b], n=1)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	pairs, ok := AttributePairs(defs[0], "headers")
+	expected := []KV{{"Accept", "text/html"}, {"Accept", "application/json"}, {"Retry", int64(3)}}
+	if !ok || len(pairs) != len(expected) {
+		t.Fatalf("headers should be %v but got %v", expected, pairs)
+	}
+	for i := range expected {
+		if pairs[i] != expected[i] {
+			t.Fatalf("headers should be %v but got %v", expected, pairs)
+		}
+	}
+	for _, name := range []string{"bad", "badkey", "flat", "n", "missing"} {
+		if pairs, ok := AttributePairs(defs[0], name); ok || pairs != nil {
+			t.Fatalf("%s should not be pairs but got %v", name, pairs)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package stagparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DescribeFunc returns a human-readable description of a definition.
+type DescribeFunc func(def Definition) string
+
+var defaultDescriptions = map[string]DescribeFunc{
+	"required": func(def Definition) string {
+		return "required"
+	},
+	"length": func(def Definition) string {
+		lo, hasLo := def.Attribute("min")
+		hi, hasHi := def.Attribute("max")
+		switch {
+		case hasLo && hasHi:
+			return fmt.Sprintf("length between %v and %v", lo, hi)
+		case hasLo:
+			return fmt.Sprintf("length at least %v", lo)
+		case hasHi:
+			return fmt.Sprintf("length at most %v", hi)
+		}
+		return "length"
+	},
+	"min": func(def Definition) string {
+		v, _ := def.Attribute("min")
+		return fmt.Sprintf("at least %v", v)
+	},
+	"max": func(def Definition) string {
+		v, _ := def.Attribute("max")
+		return fmt.Sprintf("at most %v", v)
+	},
+}
+
+// Describe converts given definitions into a human-readable text like
+// "required; length between 1 and 10".
+// Definitions without built-in descriptions are described in tag syntax.
+func Describe(defs []Definition) string {
+	return DescribeWith(defs, nil)
+}
+
+// DescribeWith is like Describe, but descriptions in overrides take precedence
+// over built-in ones.
+func DescribeWith(defs []Definition, overrides map[string]DescribeFunc) string {
+	parts := make([]string, 0, len(defs))
+	for _, def := range defs {
+		f, ok := overrides[def.Name()]
+		if !ok {
+			f, ok = defaultDescriptions[def.Name()]
+		}
+		if ok {
+			parts = append(parts, f(def))
+			continue
+		}
+		s, err := marshalDefinition(def)
+		if err != nil {
+			s = def.Name()
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
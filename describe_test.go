@@ -0,0 +1,33 @@
+package stagparser_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func TestDescribe(t *testing.T) {
+	defs, err := ParseTag("required,length(min=1, max=10),length(max=5),unknown(x=1)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	expected := "required; length between 1 and 10; length at most 5; unknown(x=1)"
+	if s := Describe(defs); s != expected {
+		t.Fatalf("description should be %q but got %q", expected, s)
+	}
+
+	s := DescribeWith(defs, map[string]DescribeFunc{
+		"unknown": func(def Definition) string {
+			v, _ := def.Attribute("x")
+			return fmt.Sprintf("x is %v", v)
+		},
+		"required": func(def Definition) string {
+			return "must be set"
+		},
+	})
+	expected = "must be set; length between 1 and 10; length at most 5; x is 1"
+	if s != expected {
+		t.Fatalf("description should be %q but got %q", expected, s)
+	}
+}
@@ -0,0 +1,78 @@
+package stagparser
+
+// ToDescriptor converts given definitions into a nested map shaped like
+// protobuf field options of protoc-gen-validate. Recognized definitions are:
+//
+//   - required: {"required": true}
+//   - length(min=1, max=10): {"string": {"min_len": 1, "max_len": 10}}
+//   - pattern='^a': {"string": {"pattern": "^a"}}
+//   - min=1, max=10: {"number": {"gte": 1, "lte": 10}}
+//   - in=[a, b]: {"in": [a, b]}
+//
+// Other definitions are preserved under the "extra" key in the ToMap form.
+func ToDescriptor(defs []Definition) map[string]interface{} {
+	result := map[string]interface{}{}
+	group := func(key string) map[string]interface{} {
+		m, ok := result[key].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			result[key] = m
+		}
+		return m
+	}
+	extra := map[string]interface{}{}
+	for _, def := range defs {
+		attrs := def.Attributes()
+		switch def.Name() {
+		case "required":
+			result["required"] = true
+			continue
+		case "length":
+			minLen, hasMin := attrs["min"]
+			maxLen, hasMax := attrs["max"]
+			if len(attrs) != 0 && len(attrs) == btoi(hasMin)+btoi(hasMax) {
+				if hasMin {
+					group("string")["min_len"] = minLen
+				}
+				if hasMax {
+					group("string")["max_len"] = maxLen
+				}
+				continue
+			}
+		case "pattern", "min", "max", "in":
+			if v, ok := attrs[def.Name()]; ok && len(attrs) == 1 {
+				switch def.Name() {
+				case "pattern":
+					group("string")["pattern"] = v
+				case "min":
+					group("number")["gte"] = v
+				case "max":
+					group("number")["lte"] = v
+				case "in":
+					result["in"] = v
+				}
+				continue
+			}
+		}
+		if v, ok := attrs[def.Name()]; ok && len(attrs) == 1 {
+			extra[def.Name()] = v
+			continue
+		}
+		m := make(map[string]interface{}, len(attrs))
+		for key, value := range attrs {
+			m[key] = value
+		}
+		extra[def.Name()] = m
+	}
+	if len(extra) != 0 {
+		result["extra"] = extra
+	}
+	return result
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package stagparser_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func TestToDescriptor(t *testing.T) {
+	defs, err := ParseTag("required, length(min=1, max=10), pattern='^[a-z]+$', max=100, "+
+		"format=email, unique, range(min=1, step=2)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	expected := map[string]interface{}{
+		"required": true,
+		"string": map[string]interface{}{
+			"min_len": int64(1),
+			"max_len": int64(10),
+			"pattern": "^[a-z]+$",
+		},
+		"number": map[string]interface{}{
+			"lte": int64(100),
+		},
+		"extra": map[string]interface{}{
+			"format": "email",
+			"unique": map[string]interface{}{},
+			"range":  map[string]interface{}{"min": int64(1), "step": int64(2)},
+		},
+	}
+	if d := ToDescriptor(defs); !reflect.DeepEqual(d, expected) {
+		t.Fatalf("expected %v but got %v", expected, d)
+	}
+
+	defs, _ = ParseTag("length(min=1, unit=bytes)", "t")
+	d := ToDescriptor(defs)
+	if _, ok := d["string"]; ok {
+		t.Fatalf("length with unknown attributes should be preserved as extra: %v", d)
+	}
+	if _, ok := d["extra"].(map[string]interface{})["length"]; !ok {
+		t.Fatalf("length should be in extra: %v", d)
+	}
+}
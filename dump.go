@@ -0,0 +1,65 @@
+package stagparser
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dump returns an indented tree of given definitions for debugging.
+// Attributes are sorted by name and shown with their Go types:
+//
+//	length
+//	  max: 10 (int64)
+//	  min: 1 (int64)
+//
+// Arrays and objects are expanded into nested lines.
+func Dump(defs []Definition) string {
+	var buf bytes.Buffer
+	for _, def := range defs {
+		buf.WriteString(def.Name())
+		buf.WriteByte('\n')
+		attrs := def.Attributes()
+		for _, key := range sortedKeys(attrs) {
+			dumpValue(&buf, 1, key+": ", attrs[key])
+		}
+	}
+	return buf.String()
+}
+
+func dumpValue(buf *bytes.Buffer, depth int, prefix string, value interface{}) {
+	indent := strings.Repeat("  ", depth)
+	switch v := value.(type) {
+	case nil:
+		fmt.Fprintf(buf, "%s%snull\n", indent, prefix)
+	case []interface{}:
+		fmt.Fprintf(buf, "%s%s(%T)\n", indent, prefix, v)
+		for _, e := range v {
+			dumpValue(buf, depth+1, "- ", e)
+		}
+	case map[string]interface{}:
+		fmt.Fprintf(buf, "%s%s(%T)\n", indent, prefix, v)
+		for _, key := range sortedKeys(v) {
+			dumpValue(buf, depth+1, key+": ", v[key])
+		}
+	case CompositeLit:
+		fmt.Fprintf(buf, "%s%s(%T)\n", indent, prefix, v)
+		for _, key := range sortedKeys(v.Fields) {
+			dumpValue(buf, depth+1, key+": ", v.Fields[key])
+		}
+	case string:
+		fmt.Fprintf(buf, "%s%s%q (%T)\n", indent, prefix, v, v)
+	default:
+		fmt.Fprintf(buf, "%s%s%v (%T)\n", indent, prefix, v, v)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,34 @@
+package stagparser_test
+
+import (
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func TestDump(t *testing.T) {
+	defs, err := ParseTagWithOptions("required,length(min=1, max=10),in(values=[1,'a',[2.5,null]]),"+
+		"def(v={Name: 'x', On: true})", "t", WithGoComposites())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	expected := `required
+length
+  max: 10 (int64)
+  min: 1 (int64)
+in
+  values: ([]interface {})
+    - 1 (int64)
+    - "a" (string)
+    - ([]interface {})
+      - 2.5 (float64)
+      - null
+def
+  v: (stagparser.CompositeLit)
+    Name: "x" (string)
+    On: true (bool)
+`
+	if s := Dump(defs); s != expected {
+		t.Fatalf("dump should be\n%s\nbut got\n%s", expected, s)
+	}
+}
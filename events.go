@@ -0,0 +1,61 @@
+package stagparser
+
+// EventHandler receives events from ParseEvents.
+type EventHandler interface {
+	// DefinitionStart is called at the start of a definition
+	DefinitionStart(name string)
+	// Attribute is called for an attribute and an array element. key is
+	// empty for array elements
+	Attribute(key string, value interface{})
+	// ArrayStart is called at the start of an array. key is empty for
+	// arrays in arrays
+	ArrayStart(key string)
+	// ArrayEnd is called at the end of an array
+	ArrayEnd()
+	// DefinitionEnd is called at the end of a definition
+	DefinitionEnd()
+}
+
+// ParseEvents parses a given tag value and calls methods of h while
+// definitions are parsed, without building definitions. Attributes are
+// reported in source order, so a duplicated attribute is reported for each
+// occurrence. Array values are reported as ArrayStart, an Attribute per
+// element and ArrayEnd. When ParseEvents returns a parse error, events of
+// preceding definitions and attributes are already reported.
+func ParseEvents(value string, name string, h EventHandler) error {
+	p := newParser(name)
+	p.events = h
+	return p.parse(value, func(Definition) error {
+		p.startDefinition()
+		h.DefinitionEnd()
+		return nil
+	})
+}
+
+// emitAttribute reports an attribute of the definition being parsed.
+func (p *parser) emitAttribute(key string, value interface{}) {
+	p.startDefinition()
+	emitValueEvents(p.events, key, value)
+}
+
+// startDefinition reports the start of the definition being parsed if it is
+// not reported yet.
+func (p *parser) startDefinition() {
+	if len(p.pending) != 0 {
+		p.events.DefinitionStart(p.pending)
+		p.pending = ""
+	}
+}
+
+func emitValueEvents(h EventHandler, key string, value interface{}) {
+	array, ok := value.([]interface{})
+	if !ok {
+		h.Attribute(key, value)
+		return
+	}
+	h.ArrayStart(key)
+	for _, e := range array {
+		emitValueEvents(h, "", e)
+	}
+	h.ArrayEnd()
+}
@@ -0,0 +1,102 @@
+package stagparser_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) DefinitionStart(name string) {
+	r.events = append(r.events, "start "+name)
+}
+
+func (r *recorder) Attribute(key string, value interface{}) {
+	r.events = append(r.events, fmt.Sprintf("attr %s=%v", key, value))
+}
+
+func (r *recorder) ArrayStart(key string) {
+	r.events = append(r.events, "array "+key)
+}
+
+func (r *recorder) ArrayEnd() {
+	r.events = append(r.events, "array end")
+}
+
+func (r *recorder) DefinitionEnd() {
+	r.events = append(r.events, "end")
+}
+
+func TestParseEvents(t *testing.T) {
+	r := &recorder{}
+	err := ParseEvents("required,length(min=1, max=10),in(values=[a, [1, 2]], strict=true)", "t", r)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	expected := []string{
+		"start required",
+		"end",
+		"start length",
+		"attr min=1",
+		"attr max=10",
+		"end",
+		"start in",
+		"array values",
+		"attr =a",
+		"array ",
+		"attr =1",
+		"attr =2",
+		"array end",
+		"array end",
+		"attr strict=true",
+		"end",
+	}
+	if s := strings.Join(r.events, "\n"); s != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected events:\n%s", s)
+	}
+
+	r = &recorder{}
+	if err := ParseEvents("required,max=(", "t", r); err == nil {
+		t.Fatal("should be an error")
+	}
+	if len(r.events) != 2 {
+		t.Fatalf("events before the error should be reported: %v", r.events)
+	}
+
+	r = &recorder{}
+	if err := ParseEvents("length(min=1, min=2)", "t", r); err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if s := strings.Join(r.events, ","); s != "start length,attr min=1,attr min=2,end" {
+		t.Fatalf("each attribute should be reported as it is parsed: %s", s)
+	}
+}
+
+type nopHandler struct{}
+
+func (nopHandler) DefinitionStart(string)        {}
+func (nopHandler) Attribute(string, interface{}) {}
+func (nopHandler) ArrayStart(string)             {}
+func (nopHandler) ArrayEnd()                     {}
+func (nopHandler) DefinitionEnd()                {}
+
+const benchmarkEventsTag = "required,length(min=1, max=10),in(values=[a, b, c])"
+
+func BenchmarkParseEvents(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = ParseEvents(benchmarkEventsTag, "t", nopHandler{})
+	}
+}
+
+func BenchmarkParseEventsParseTag(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseTag(benchmarkEventsTag, "t")
+	}
+}
@@ -0,0 +1,99 @@
+package stagparser
+
+import (
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+)
+
+// ParseFile parses struct tags in a Go source file without loading its
+// package. Unlike ParseStruct, ParseFile works on the syntax tree, so it
+// handles unexported and generic types uniformly. The first map key is a
+// struct type name and the second is a field name. Structs without given
+// tags are omitted.
+func ParseFile(filename string, tag string) (map[string]map[string][]Definition, error) {
+	f, err := goparser.ParseFile(token.NewFileSet(), filename, nil, goparser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]map[string][]Definition{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return true
+		}
+		var fields map[string][]Definition
+		fields, err = parseASTFields(spec.Name.Name, st, tag)
+		if len(fields) != 0 {
+			result[spec.Name.Name] = fields
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func parseASTFields(typeName string, st *ast.StructType, tag string) (map[string][]Definition, error) {
+	result := map[string][]Definition{}
+	for _, field := range st.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		s, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return nil, err
+		}
+		value := reflect.StructTag(s).Get(tag)
+		if len(value) == 0 {
+			continue
+		}
+		for _, name := range astFieldNames(field) {
+			defs, err := ParseTag(value, typeName+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			result[name] = defs
+		}
+	}
+	return result, nil
+}
+
+// astFieldNames returns names of a field. An embedded field is named after
+// its type like reflect does.
+func astFieldNames(field *ast.Field) []string {
+	if len(field.Names) != 0 {
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		return names
+	}
+	typ := field.Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.SelectorExpr:
+			return []string{t.Sel.Name}
+		case *ast.Ident:
+			return []string{t.Name}
+		default:
+			return nil
+		}
+	}
+}
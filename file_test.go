@@ -0,0 +1,79 @@
+package stagparser_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+const fileSource = `package models
+
+import "time"
+
+type user struct {
+	Name, Nickname string ` + "`validate:\"required,max=10\"`" + `
+	Age            int    ` + "`validate:\"range(min=0, max=150)\" json:\"age\"`" + `
+	note           string
+	*time.Location ` + "`validate:\"required\"`" + `
+}
+
+type Page[T any] struct {
+	Items []T ` + "`validate:\"max=100\"`" + `
+}
+
+type Empty struct {
+	ID int ` + "`json:\"id\"`" + `
+}
+`
+
+func writeSource(t *testing.T, src string) string {
+	filename := filepath.Join(t.TempDir(), "models.go")
+	if err := os.WriteFile(filename, []byte(src), 0o600); err != nil {
+		t.Fatalf("failed to write a source file: %s", err.Error())
+	}
+	return filename
+}
+
+func TestParseFile(t *testing.T) {
+	result, err := ParseFile(writeSource(t, fileSource), "validate")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(result) != 2 {
+		t.Fatalf("2 structs should be found but got %d", len(result))
+	}
+	user := result["user"]
+	if len(user) != 4 {
+		t.Fatalf("user should have 4 fields but got %d", len(user))
+	}
+	for _, name := range []string{"Name", "Nickname"} {
+		defs := user[name]
+		if len(defs) != 2 || defs[0].Name() != "required" || defs[1].Name() != "max" {
+			t.Fatalf("unexpected definitions of %s: %v", name, defs)
+		}
+	}
+	if v, _ := user["Age"][0].Attribute("max"); v != int64(150) {
+		t.Fatalf("Age.range.max should be 150 but got %v", v)
+	}
+	if defs := user["Location"]; len(defs) != 1 || defs[0].Name() != "required" {
+		t.Fatalf("unexpected definitions of Location: %v", defs)
+	}
+	if v, _ := result["Page"]["Items"][0].Attribute("max"); v != int64(100) {
+		t.Fatalf("Page.Items.max should be 100 but got %v", v)
+	}
+}
+
+func TestParseFileError(t *testing.T) {
+	_, err := ParseFile(writeSource(t, "package models\n\ntype A struct {\n\tX int `v:\"max=(\"`\n}\n"), "v")
+	if err == nil {
+		t.Fatal("should be an error")
+	}
+	if _, ok := err.(ParseError); !ok {
+		t.Fatalf("should be a ParseError but got %T", err)
+	}
+	if _, err := ParseFile(writeSource(t, "package models\n\ntype A struct {"), "v"); err == nil {
+		t.Fatal("should be a syntax error")
+	}
+}
@@ -0,0 +1,71 @@
+package stagparser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+)
+
+// Hash returns a FNV-1a hash of definition names and attributes. Hash
+// depends on the order of definitions and types of values, but not on
+// source forms like whitespaces and attribute order.
+func Hash(defs []Definition) uint64 {
+	h := fnv.New64a()
+	for _, def := range defs {
+		writeHashString(h, 'd', def.Name())
+		writeHashValue(h, def.Attributes())
+	}
+	return h.Sum64()
+}
+
+func writeHashString(h hash.Hash64, kind byte, s string) {
+	writeHashUint(h, kind, uint64(len(s)))
+	_, _ = h.Write([]byte(s))
+}
+
+func writeHashUint(h hash.Hash64, kind byte, v uint64) {
+	var buf [9]byte
+	buf[0] = kind
+	binary.BigEndian.PutUint64(buf[1:], v)
+	_, _ = h.Write(buf[:])
+}
+
+func writeHashValue(h hash.Hash64, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		_, _ = h.Write([]byte{'n'})
+	case bool:
+		if v {
+			writeHashUint(h, 'b', 1)
+		} else {
+			writeHashUint(h, 'b', 0)
+		}
+	case int64:
+		writeHashUint(h, 'i', uint64(v))
+	case float64:
+		writeHashUint(h, 'f', math.Float64bits(v))
+	case string:
+		writeHashString(h, 's', v)
+	case []interface{}:
+		writeHashUint(h, 'a', uint64(len(v)))
+		for _, e := range v {
+			writeHashValue(h, e)
+		}
+	case map[string]interface{}:
+		writeHashUint(h, 'm', uint64(len(v)))
+		for _, key := range sortedKeys(v) {
+			writeHashString(h, 'k', key)
+			writeHashValue(h, v[key])
+		}
+	default:
+		// pointers like *template.Template are hashed by their canonical
+		// form, not by their addresses
+		s, err := marshalValue(v)
+		if err != nil {
+			s = fmt.Sprint(v)
+		}
+		writeHashString(h, 'o', fmt.Sprintf("%T:%s", v, s))
+	}
+}
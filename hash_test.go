@@ -0,0 +1,52 @@
+package stagparser_test
+
+import (
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func TestHash(t *testing.T) {
+	hash := func(tag string) uint64 {
+		defs, err := ParseTagWithOptions(tag, "t", WithColorLiterals())
+		if err != nil {
+			t.Fatalf("parse failed: %s", err.Error())
+		}
+		return Hash(defs)
+	}
+	for _, c := range [][2]string{
+		{"length( min=1 )", "length(min=1)"},
+		{"length(min=1, max=10)", "length(max=10,min=1)"},
+		{"in(v=[1, 'a', {k=null}])", "in(v=[1,a,{ k=null }])"},
+		{"c=#fff", "c=#ffffff"},
+	} {
+		if hash(c[0]) != hash(c[1]) {
+			t.Fatalf("%s and %s should have the same hash", c[0], c[1])
+		}
+	}
+	for _, c := range [][2]string{
+		{"length(min=1)", "length(min=2)"},
+		{"length(min=1)", "length(min=1.0)"},
+		{"length(min=1)", "length(min='1')"},
+		{"a,b", "b,a"},
+		{"a=1", "b=1"},
+		{"in(v=[1, 2])", "in(v=[[1, 2]])"},
+		{"a(x='bc')", "a(xb='c')"},
+		{"a=true", "a='true'"},
+	} {
+		if hash(c[0]) == hash(c[1]) {
+			t.Fatalf("%s and %s should have different hashes", c[0], c[1])
+		}
+	}
+
+	tmpl := func() uint64 {
+		defs, err := ParseTagWithOptions("m(t='{{.X}}')", "t", WithTemplateLiterals())
+		if err != nil {
+			t.Fatalf("parse failed: %s", err.Error())
+		}
+		return Hash(defs)
+	}
+	if tmpl() != tmpl() {
+		t.Fatalf("identical templates should have the same hash")
+	}
+}
@@ -0,0 +1,313 @@
+package stagparser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Marshal serializes given definitions into a canonical tag value.
+// Attributes are sorted by name and strings are always quoted.
+// Parsing the result with ParseTag yields equivalent definitions.
+// Marshal returns an error if an attribute value is of an unsupported type.
+func Marshal(defs []Definition) (string, error) {
+	return marshal(defs)
+}
+
+// MarshalForTag serializes given definitions into a tag value that can be
+// embedded in a Go struct tag literal like `key:"value"`.
+func MarshalForTag(defs []Definition) (string, error) {
+	s, err := marshal(defs)
+	if err != nil {
+		return "", err
+	}
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1], nil
+}
+
+func marshal(defs []Definition) (string, error) {
+	parts := make([]string, 0, len(defs))
+	for _, def := range defs {
+		s, err := marshalDefinition(def)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func marshalDefinition(def Definition) (string, error) {
+	attrs := def.Attributes()
+	if len(attrs) == 0 {
+		if def.HasParens() {
+			return def.Name() + "()", nil
+		}
+		return def.Name(), nil
+	}
+	if v, ok := attrs[def.Name()]; ok && len(attrs) == 1 && !def.HasParens() {
+		s, err := marshalValue(v)
+		if err != nil {
+			return "", err
+		}
+		return def.Name() + "=" + s, nil
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.WriteString(def.Name())
+	buf.WriteByte('(')
+	for i, key := range keys {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		s, err := marshalValue(attrs[key])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(s)
+	}
+	buf.WriteByte(')')
+	return buf.String(), nil
+}
+
+func marshalValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return "", fmt.Errorf("unsupported float value: %v", v)
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	case complex128:
+		s := strconv.FormatComplex(v, 'g', -1, 128)
+		return s[1 : len(s)-1], nil
+	case string:
+		return quoteString(v), nil
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			s, err := marshalValue(e)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return "[" + strings.Join(parts, ",") + "]", nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			s, err := marshalValue(v[key])
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, key+"="+s)
+		}
+		return "{" + strings.Join(parts, ",") + "}", nil
+	case map[string][]Definition:
+		fields := make([]string, 0, len(v))
+		for field := range v {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		parts := make([]string, 0, len(fields))
+		for _, field := range fields {
+			s, err := marshal(v[field])
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, field+":"+s)
+		}
+		return "<" + strings.Join(parts, ",") + ">", nil
+	case CompositeLit:
+		keys := make([]string, 0, len(v.Fields))
+		for key := range v.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			s, err := marshalValue(v.Fields[key])
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, key+":"+s)
+		}
+		return "{" + strings.Join(parts, ",") + "}", nil
+	case *template.Template:
+		return quoteString(v.Tree.Root.String()), nil
+	case []byte:
+		return "b64:" + base64.StdEncoding.EncodeToString(v), nil
+	case FieldRef, Color, SliceRef, Placeholder, Range, Rate, UUID, net.HardwareAddr:
+		return v.(fmt.Stringer).String(), nil
+	}
+	return "", fmt.Errorf("unsupported value type: %T", value)
+}
+
+func quoteString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('\'')
+	for _, ch := range s {
+		switch ch {
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\'':
+			buf.WriteString(`\'`)
+		default:
+			if ch < 0x20 || ch == 0x7f {
+				fmt.Fprintf(&buf, `\x%02x`, ch)
+			} else {
+				buf.WriteRune(ch)
+			}
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+// ToMap converts given definitions into a map keyed by definition names.
+// Values of the map are:
+//
+//   - an empty map for a definition without attributes: required
+//   - an attribute value for a name with a single non-null attribute: max=10
+//   - a map of attributes for others: length(min=1, max=10)
+//
+// Definition names must be unique.
+func ToMap(defs []Definition) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		if _, ok := result[def.Name()]; ok {
+			return nil, fmt.Errorf("duplicated definition: %s", def.Name())
+		}
+		attrs := def.Attributes()
+		if v, ok := attrs[def.Name()]; ok && v != nil && len(attrs) == 1 {
+			if _, isMap := v.(map[string]interface{}); !isMap {
+				result[def.Name()] = v
+				continue
+			}
+		}
+		m := make(map[string]interface{}, len(attrs))
+		for key, value := range attrs {
+			m[key] = value
+		}
+		result[def.Name()] = m
+	}
+	return result, nil
+}
+
+// FromMap converts a map described in ToMap into definitions sorted by name.
+// nil values are treated as empty maps. Go integer and float values are
+// converted into int64 and float64.
+func FromMap(m map[string]interface{}) ([]Definition, error) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]Definition, 0, len(m))
+	for _, name := range names {
+		attrs := map[string]interface{}{}
+		switch v := m[name].(type) {
+		case nil:
+		case map[string]interface{}:
+			for key, value := range v {
+				nv, err := normalizeValue(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", name, key, err)
+				}
+				attrs[key] = nv
+			}
+		default:
+			nv, err := normalizeValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			attrs[name] = nv
+		}
+		result = append(result, newDefinition(name, attrs))
+	}
+	return result, nil
+}
+
+func normalizeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, int64, float64, string, bool:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			ne, err := normalizeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, ne)
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, e := range v {
+			ne, err := normalizeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = ne
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unsupported value type: %T", value)
+}
@@ -0,0 +1,188 @@
+package stagparser_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func assertDefinitionsEqual(t *testing.T, expected, actual []Definition) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Fatalf("%d definitions expected but got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if expected[i].Name() != actual[i].Name() {
+			t.Fatalf("definition %d should be '%s' but got '%s'", i, expected[i].Name(), actual[i].Name())
+		}
+		if !reflect.DeepEqual(expected[i].Attributes(), actual[i].Attributes()) {
+			t.Fatalf("'%s' should have %v but got %v", expected[i].Name(), expected[i].Attributes(), actual[i].Attributes())
+		}
+	}
+}
+
+func TestMarshalForTag(t *testing.T) {
+	defs, err := ParseTag(`required,msg='say "hi"\\\t',length(min=1, max='a,b'),pkr=[1, -100.009, aaa, 2.0]`, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	value, err := MarshalForTag(defs)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err.Error())
+	}
+	tag := reflect.StructTag(`t:"` + value + `"`)
+	unquoted, ok := tag.Lookup("t")
+	if !ok {
+		t.Fatalf("%s should be a valid struct tag", tag)
+	}
+	reparsed, err := ParseTag(unquoted, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	assertDefinitionsEqual(t, defs, reparsed)
+}
+
+func TestMapRoundTrip(t *testing.T) {
+	defs, err := ParseTag("length(max=10,min=1),max=10,pkr=[1, -100.009, aaa],required", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	m, err := ToMap(defs)
+	if err != nil {
+		t.Fatalf("ToMap failed: %s", err.Error())
+	}
+	if v, ok := m["max"].(int64); !ok || v != 10 {
+		t.Fatalf("max should be converted into 10(int64) but got %v(%T)", m["max"], m["max"])
+	}
+	if v, ok := m["required"].(map[string]interface{}); !ok || len(v) != 0 {
+		t.Fatalf("required should be converted into an empty map but got %v(%T)", m["required"], m["required"])
+	}
+	result, err := FromMap(m)
+	if err != nil {
+		t.Fatalf("FromMap failed: %s", err.Error())
+	}
+	assertDefinitionsEqual(t, defs, result)
+
+	result, err = FromMap(map[string]interface{}{
+		"length":   map[string]interface{}{"min": 1, "max": float32(2.5)},
+		"required": nil,
+	})
+	if err != nil {
+		t.Fatalf("FromMap failed: %s", err.Error())
+	}
+	if v, _ := result[0].Attribute("min"); v.(int64) != 1 {
+		t.Fatalf("min should be converted into 1(int64) but got %v(%T)", v, v)
+	}
+	if v, _ := result[0].Attribute("max"); v.(float64) != 2.5 {
+		t.Fatalf("max should be converted into 2.5(float64) but got %v(%T)", v, v)
+	}
+
+	if _, err := ToMap(append(defs, defs[0])); err == nil {
+		t.Fatalf("duplicated definitions should be an error")
+	}
+	if _, err := FromMap(map[string]interface{}{"max": struct{}{}}); err == nil {
+		t.Fatalf("unsupported value types should be an error")
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	defs, err := ParseTagWithOptions("required,stu(vwx=ccc, zzz=ddd),pkr=[1, -100.009,'a\tb',[2]],opt(y=1, flag)", "t",
+		WithFlagArgs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	b, err := MarshalYAML(defs)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err.Error())
+	}
+	expected := `- name: "required"
+  attributes: {}
+- name: "stu"
+  attributes:
+    vwx: "ccc"
+    zzz: "ddd"
+- name: "pkr"
+  attributes:
+    pkr:
+      - 1
+      - -100.009
+      - "a\tb"
+      -
+        - 2
+- name: "opt"
+  attributes:
+    flag: true
+    "y": 1
+`
+	if string(b) != expected {
+		t.Fatalf("YAML should be\n%s\nbut got\n%s", expected, string(b))
+	}
+
+	defs, err = ParseTagWithOptions("c(v=#ff0000ff, u={Age:30,Name:'x'})", "t",
+		WithColorLiterals(), WithGoComposites())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	b, err = MarshalYAML(defs)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err.Error())
+	}
+	expected = `- name: "c"
+  attributes:
+    u: "{Age:30,Name:'x'}"
+    v: "#ff0000ff"
+`
+	if string(b) != expected {
+		t.Fatalf("YAML should be\n%s\nbut got\n%s", expected, string(b))
+	}
+
+	b, _ = MarshalYAML(nil)
+	if string(b) != "[]\n" {
+		t.Fatalf("YAML of no definitions should be an empty sequence but got %s", string(b))
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	tag := `abc=1,def=ghi,jkl='mno',pkr=[1, -100.009, aaa, 2.0],stu(vwx=ccc, zzz='d\td'),a1,a2(),` +
+		`length(min=1, max='a,b'),quote='it\'s (ok)\n'`
+	defs, err := ParseTag(tag, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	s, err := Marshal(defs)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err.Error())
+	}
+	expected := `abc=1,def='ghi',jkl='mno',pkr=[1,-100.009,'aaa',2.0],stu(vwx='ccc',zzz='d\td'),a1,a2(),` +
+		`length(max='a,b',min=1),quote='it\'s (ok)\n'`
+	if s != expected {
+		t.Fatalf("tag should be marshalled into\n%s\nbut got\n%s", expected, s)
+	}
+	reparsed, err := ParseTag(s, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	assertDefinitionsEqual(t, defs, reparsed)
+	for i, def := range reparsed {
+		if def.HasParens() != defs[i].HasParens() {
+			t.Fatalf("HasParens of '%s' should be preserved", def.Name())
+		}
+	}
+
+	if s := defs[7].String(); s != "length(max='a,b',min=1)" {
+		t.Fatalf("String should return length(max='a,b',min=1) but got %s", s)
+	}
+
+	defs, _ = ParseTagWithOptions("c=#ff0000,ref=$User.Name,lit={A:1}", "t", WithColorLiterals(), WithFieldRefs(),
+		WithGoComposites())
+	if s, err := Marshal(defs); err != nil || s != "c=#ff0000ff,ref=$User.Name,lit={A:1}" {
+		t.Fatalf("tag should be marshalled into c=#ff0000ff,ref=$User.Name,lit={A:1} but got %s, %v", s, err)
+	}
+
+	defs, _ = FromMap(map[string]interface{}{"max": 10})
+	defs[0].Attributes()["max"] = struct{}{}
+	if _, err := Marshal(defs); err == nil {
+		t.Fatalf("unsupported value types should be an error")
+	}
+}
@@ -0,0 +1,510 @@
+package stagparser
+
+// ParserOption is an option for the parser.
+type ParserOption func(*parserConfig)
+
+type parserConfig struct {
+	separator rune
+
+	indexedKeys    bool
+	indexedKeyGaps bool
+
+	descriptionComments bool
+
+	flagArgs bool
+
+	fieldRefs bool
+
+	arithmetic bool
+
+	extends string
+
+	colorLiterals bool
+
+	defaultAttributes map[string]map[string]interface{}
+
+	trailingFlags bool
+
+	spaceArgs bool
+
+	percentDecoding bool
+
+	recoverFunc func(err ParseError) bool
+
+	rawDefinitions map[string]bool
+
+	pathValues bool
+
+	timezoneLiterals bool
+
+	goComposites bool
+
+	sliceRefs bool
+
+	positionalArgs bool
+
+	placeholders bool
+
+	identRunes func(ch rune, i int) bool
+
+	boolAliases map[string]bool
+
+	macLiterals bool
+
+	strict bool
+
+	noDuplicates bool
+
+	base64Literals bool
+
+	templateLiterals bool
+
+	quotedNames bool
+
+	dashRanges bool
+
+	typedValues bool
+
+	strictCommas bool
+
+	nestedTags bool
+
+	deprecated map[string]string
+
+	tokenizer func(input string) Tokenizer
+
+	complexLiterals bool
+
+	arrayDedup bool
+
+	constants bool
+
+	stringMaxLen map[string]int
+
+	leadingSigil rune
+
+	rateLiterals bool
+
+	uuidLiterals bool
+
+	skipUnknown bool
+}
+
+func newParserConfig(opts []ParserOption) parserConfig {
+	c := parserConfig{
+		separator: ',',
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithSeparator sets a separator between definitions. Defaults to ','.
+func WithSeparator(sep rune) ParserOption {
+	return func(c *parserConfig) {
+		c.separator = sep
+	}
+}
+
+// WithIndexedKeys collapses attributes that have a common prefix and
+// numeric suffixes into an array: point(x0=1, x1=2) is parsed as
+// point(x=[1, 2]). Indices must be contiguous and start at 0.
+func WithIndexedKeys() ParserOption {
+	return func(c *parserConfig) {
+		c.indexedKeys = true
+	}
+}
+
+// WithIndexedKeyGaps is like WithIndexedKeys, but allows missing indices.
+// Missing elements are set to nil.
+func WithIndexedKeyGaps() ParserOption {
+	return func(c *parserConfig) {
+		c.indexedKeys = true
+		c.indexedKeyGaps = true
+	}
+}
+
+// WithDescriptionComments makes a comment(/* */ or //) preceding a definition
+// available as Definition.Description. Comments are ignored by default.
+func WithDescriptionComments() ParserOption {
+	return func(c *parserConfig) {
+		c.descriptionComments = true
+	}
+}
+
+// WithFlagArgs allows attributes without values in an argument list.
+// field(readonly, !cached) is parsed as field(readonly=true, cached=false).
+func WithFlagArgs() ParserOption {
+	return func(c *parserConfig) {
+		c.flagArgs = true
+	}
+}
+
+// WithFieldRefs enables field references like $User.Address.Zip in values.
+// A field reference is parsed as a FieldRef.
+func WithFieldRefs() ParserOption {
+	return func(c *parserConfig) {
+		c.fieldRefs = true
+	}
+}
+
+// WithArithmetic enables arithmetic expressions(+, -, *, / and parentheses)
+// over numeric literals in values. size(max=1024*1024) is parsed as
+// size(max=1048576).
+func WithArithmetic() ParserOption {
+	return func(c *parserConfig) {
+		c.arithmetic = true
+	}
+}
+
+// WithExtends enables a definition that inherits definitions of other fields
+// in ParseStructWithOptions. If defName is "extends", extends(Base) is replaced
+// with definitions of the field Base. Inheritance cycles are errors.
+func WithExtends(defName string) ParserOption {
+	return func(c *parserConfig) {
+		c.extends = defName
+	}
+}
+
+// WithColorLiterals enables color literals(#RGB, #RRGGBB and #RRGGBBAA) in values.
+// A color literal is parsed as a Color.
+func WithColorLiterals() ParserOption {
+	return func(c *parserConfig) {
+		c.colorLiterals = true
+	}
+}
+
+// WithDefaultAttributes sets default attributes keyed by a definition name.
+// Defaults are merged into attributes of parsed definitions without
+// overriding explicit values.
+func WithDefaultAttributes(defaults map[string]map[string]interface{}) ParserOption {
+	return func(c *parserConfig) {
+		if c.defaultAttributes == nil {
+			c.defaultAttributes = map[string]map[string]interface{}{}
+		}
+		for name, attrs := range defaults {
+			if c.defaultAttributes[name] == nil {
+				c.defaultAttributes[name] = map[string]interface{}{}
+			}
+			for key, value := range attrs {
+				c.defaultAttributes[name][key] = value
+			}
+		}
+	}
+}
+
+// WithTrailingFlags groups bare identifiers that follow a definition without
+// separators into the definition as flag attributes with true values.
+// 'type(kind=email) required' is parsed as a single definition
+// 'type(kind=email, required=true)' and 'email required' is parsed as
+// 'email(required=true)'.
+func WithTrailingFlags() ParserOption {
+	return func(c *parserConfig) {
+		c.trailingFlags = true
+	}
+}
+
+// WithSpaceArgs allows whitespaces as separators between attributes in
+// addition to commas: meta(author=bob role=admin).
+func WithSpaceArgs() ParserOption {
+	return func(c *parserConfig) {
+		c.spaceArgs = true
+	}
+}
+
+// WithPercentDecoding decodes %XX sequences in quoted string values.
+// Unlike url.QueryUnescape, '+' is not converted into a space.
+// Malformed sequences are errors.
+func WithPercentDecoding() ParserOption {
+	return func(c *parserConfig) {
+		c.percentDecoding = true
+	}
+}
+
+// WithRecover sets a callback that is called on each parse error.
+// If the callback returns true, the parser skips to the next definition and
+// continues. Otherwise, the parser aborts with the error.
+func WithRecover(f func(err ParseError) bool) ParserOption {
+	return func(c *parserConfig) {
+		c.recoverFunc = f
+	}
+}
+
+// WithRawDefinitions makes parenthesized bodies of given definitions
+// captured verbatim. expr(a + (b*c)) is parsed as a definition 'expr' with
+// an attribute expr="a + (b*c)".
+func WithRawDefinitions(names ...string) ParserOption {
+	return func(c *parserConfig) {
+		if c.rawDefinitions == nil {
+			c.rawDefinitions = map[string]bool{}
+		}
+		for _, name := range names {
+			c.rawDefinitions[name] = true
+		}
+	}
+}
+
+// WithPathValues enables unquoted path values that start with '/', './' or
+// '../' like path=/etc/hosts. A path value ends with a whitespace,
+// a separator or a closing bracket, so paths containing these characters
+// must be quoted.
+func WithPathValues() ParserOption {
+	return func(c *parserConfig) {
+		c.pathValues = true
+	}
+}
+
+// WithTimezoneLiterals enables time zone values like tz(zone=America/New_York).
+// An identifier followed by '/' and 'UTC' are parsed as a *time.Location.
+func WithTimezoneLiterals() ParserOption {
+	return func(c *parserConfig) {
+		c.timezoneLiterals = true
+	}
+}
+
+// WithGoComposites enables Go composite literal values like
+// default={Name: "x", Age: 30}. A composite literal is parsed as a CompositeLit.
+// This replaces object literals like {name='x'}.
+func WithGoComposites() ParserOption {
+	return func(c *parserConfig) {
+		c.goComposites = true
+	}
+}
+
+// WithSliceRefs enables slice expressions like tail=all[-2:] in values.
+// Indices may be negative. A slice expression is parsed as a SliceRef.
+func WithSliceRefs() ParserOption {
+	return func(c *parserConfig) {
+		c.sliceRefs = true
+	}
+}
+
+// WithPositionalArgs enables attributes without names. If no attributes
+// in parentheses have names, values are stored as an array under the
+// PositionalArgs attribute: in(a, b) is parsed as in(_args=[a, b]).
+// Mixing positional and named attributes is an error.
+func WithPositionalArgs() ParserOption {
+	return func(c *parserConfig) {
+		c.positionalArgs = true
+	}
+}
+
+// WithPlaceholders enables environment variable placeholders like
+// port=${PORT} and port=${PORT:-8080} in values. A placeholder is parsed
+// as a Placeholder.
+func WithPlaceholders() ParserOption {
+	return func(c *parserConfig) {
+		c.placeholders = true
+	}
+}
+
+// WithIdentRunes overrides the rule for characters of identifiers used in
+// definition names, attribute names and identifier values. f reports
+// whether ch is allowed as the i-th character of an identifier.
+// By default, identifiers follow the Go rule.
+func WithIdentRunes(f func(ch rune, i int) bool) ParserOption {
+	return func(c *parserConfig) {
+		c.identRunes = f
+	}
+}
+
+// WithBoolAliases makes given identifiers in values bool values.
+// With map[string]bool{"yes": true, "no": false}, enabled=yes is parsed as
+// enabled=true.
+func WithBoolAliases(aliases map[string]bool) ParserOption {
+	return func(c *parserConfig) {
+		if c.boolAliases == nil {
+			c.boolAliases = map[string]bool{}
+		}
+		for name, value := range aliases {
+			c.boolAliases[name] = value
+		}
+	}
+}
+
+// WithMACLiterals enables MAC address literals like mac=00:1A:2B:3C:4D:5E
+// in values. A MAC address literal is parsed as a net.HardwareAddr.
+func WithMACLiterals() ParserOption {
+	return func(c *parserConfig) {
+		c.macLiterals = true
+	}
+}
+
+// WithStrict makes tokens that would be dropped errors. Every definition
+// must be followed by a separator or the end of the tag.
+func WithStrict() ParserOption {
+	return func(c *parserConfig) {
+		c.strict = true
+	}
+}
+
+// WithNoDuplicates makes duplicated definition names in a tag and duplicated
+// attribute names in a definition errors. By default, both are allowed and
+// the last attribute wins.
+func WithNoDuplicates() ParserOption {
+	return func(c *parserConfig) {
+		c.noDuplicates = true
+	}
+}
+
+// WithBase64Literals enables base64 encoded binaries like data=b64:SGVsbG8=
+// in values. A base64 literal is decoded by base64.StdEncoding into a []byte.
+func WithBase64Literals() ParserOption {
+	return func(c *parserConfig) {
+		c.base64Literals = true
+	}
+}
+
+// WithTemplateLiterals parses quoted strings that contain {{ as templates
+// of text/template. msg(tmpl='Hello {{.Name}}') is parsed into
+// a *template.Template. Templates are validated, but not executed.
+func WithTemplateLiterals() ParserOption {
+	return func(c *parserConfig) {
+		c.templateLiterals = true
+	}
+}
+
+// WithQuotedNames allows quoted definition names and attribute names like
+// 'true'(x=1) and f('max length'=10). Quoted names are used as is, so
+// reserved words and non-identifier characters are allowed.
+func WithQuotedNames() ParserOption {
+	return func(c *parserConfig) {
+		c.quotedNames = true
+	}
+}
+
+// WithDashRanges enables ranges like age(range=18-65) in values. A range is
+// two non-negative integers joined by a dash without spaces and is parsed as
+// a Range. 5 - 3 and -5 are not ranges.
+func WithDashRanges() ParserOption {
+	return func(c *parserConfig) {
+		c.dashRanges = true
+	}
+}
+
+// WithTypedValues records source forms of attribute values. Definitions
+// returned by the parser report ValueKinds and raw texts of attribute values
+// like KindIdent for x=foo and KindString for x='foo' via AttributeTyped.
+func WithTypedValues() ParserOption {
+	return func(c *parserConfig) {
+		c.typedValues = true
+	}
+}
+
+// WithStrictCommas makes definitions that are not separated by separators
+// like 'required length' errors. By default, such a definition is dropped.
+func WithStrictCommas() ParserOption {
+	return func(c *parserConfig) {
+		c.strictCommas = true
+	}
+}
+
+// WithNestedTags enables nested tags like nested<Name:required, Age:min=0>
+// in definitions and values. Nested tags are parsed as
+// a map[string][]Definition keyed by field names.
+func WithNestedTags() ParserOption {
+	return func(c *parserConfig) {
+		c.nestedTags = true
+	}
+}
+
+// WithDeprecated sets deprecated definition names with replacement hints.
+// Deprecated definitions are parsed as usual and reported by
+// Parser.Deprecations.
+func WithDeprecated(deprecated map[string]string) ParserOption {
+	return func(c *parserConfig) {
+		if c.deprecated == nil {
+			c.deprecated = map[string]string{}
+		}
+		for name, replacement := range deprecated {
+			c.deprecated[name] = replacement
+		}
+	}
+}
+
+// WithTokenizer makes the parser read tokens produced by a Tokenizer
+// returned by f instead of scanning characters. Tokens are parsed by the same
+// grammar as the default syntax, so all options are available: a TokenString
+// is read as a quoted string and other tokens are read as their texts.
+// Tokens that are not adjacent in the input are separated by whitespaces.
+// Errors and positions are reported at positions of tokens. Source maps can
+// not be used with WithTokenizer.
+// NewScannerTokenizer returns a Tokenizer of the default syntax.
+func WithTokenizer(f func(input string) Tokenizer) ParserOption {
+	return func(c *parserConfig) {
+		c.tokenizer = f
+	}
+}
+
+// WithComplexLiterals enables complex number literals like 3+4i and 2i in
+// values. A complex number literal is parsed as a complex128.
+func WithComplexLiterals() ParserOption {
+	return func(c *parserConfig) {
+		c.complexLiterals = true
+	}
+}
+
+// WithArrayDedup removes duplicated elements in array values preserving
+// first occurrences: [a, b, a] is parsed as [a, b].
+// Elements of different types like 1 and 1.0 are not duplicates.
+func WithArrayDedup() ParserOption {
+	return func(c *parserConfig) {
+		c.arrayDedup = true
+	}
+}
+
+// WithConstants enables constants. A const definition like
+// const(LIMIT=10, NAME='x') defines constants instead of a definition and
+// @LIMIT in values refers to it. Constants can be referenced anywhere in the
+// tag. Referencing an undefined constant is an error.
+func WithConstants() ParserOption {
+	return func(c *parserConfig) {
+		c.constants = true
+	}
+}
+
+// WithStringMaxLen limits the length of string values of the named attribute
+// to n characters. An overlong value is an error at the position of
+// the value.
+func WithStringMaxLen(name string, n int) ParserOption {
+	return func(c *parserConfig) {
+		if c.stringMaxLen == nil {
+			c.stringMaxLen = map[string]int{}
+		}
+		c.stringMaxLen[name] = n
+	}
+}
+
+// WithLeadingSigil ignores the given sigil at the start of a tag value like
+// @required,length(min=1). Tag values without the sigil are also accepted.
+func WithLeadingSigil(sigil rune) ParserOption {
+	return func(c *parserConfig) {
+		c.leadingSigil = sigil
+	}
+}
+
+// WithRateLiterals enables rate literals like 10MB/s and 1GiB/m.
+// A rate literal is parsed as a Rate.
+func WithRateLiterals() ParserOption {
+	return func(c *parserConfig) {
+		c.rateLiterals = true
+	}
+}
+
+// WithUUIDLiterals enables UUID literals in the canonical form like
+// 550e8400-e29b-41d4-a716-446655440000. A UUID literal is parsed as a UUID.
+func WithUUIDLiterals() ParserOption {
+	return func(c *parserConfig) {
+		c.uuidLiterals = true
+	}
+}
+
+// WithSkipUnknown makes the parser skip tokens that can not start
+// a definition like a stray @ to the next separator instead of returning
+// an error. Parser.Skipped reports the skipped parts.
+func WithSkipUnknown() ParserOption {
+	return func(c *parserConfig) {
+		c.skipUnknown = true
+	}
+}
@@ -12,14 +12,20 @@
 //   - name with multiple attributes: length(min=1, max=10)
 //
 // name and attribute must be a golang identifier.
-// An attribute value must be one of an int64, a float64, an identifier,
-// a string quoted by "'" and an array.
+// Whitespace is allowed around names, values, commas and brackets.
+// An attribute value must be one of an int64, a float64, a bool, null,
+// an identifier, a string quoted by "'" or `"`, an array and an object.
 //
-//   - int64: 123
-//   - float64: 111.12
-//   - string: 'ab\tc'
+//   - int64: 123, 0xFF, 0o644, 0b1010
+//   - float64: 111.12, 1e6, 2.5e-3
+//   - bool: true, false
+//   - null: null, parsed as a nil interface{}
+//   - string: 'ab\tc', "don't"
+//   - \xHH escapes yield the rune U+00HH, not a raw byte
+//   - \uHHHH and \UHHHHHHHH escapes yield unicode code points
 //   - identifiers are interpreted as string in value context
 //   - array:  [1, 2, aaa]
+//   - object: {key=value, list=[1, 2]}, parsed as a map[string]interface{}
 //
 // You can parse objects just call ParseStruct:
 //
@@ -36,14 +42,29 @@
 package stagparser
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"text/scanner"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// PositionalArgs is an attribute name for positional attributes.
+// This requires WithPositionalArgs.
+const PositionalArgs = "_args"
+
 // ParseError is an error indicating invalid tag value.
 type ParseError interface {
 	error
@@ -81,86 +102,606 @@ func (e *parseError) Line() int {
 }
 
 type parser struct {
-	source string
-	s      scanner.Scanner
+	parserConfig
+	source    string
+	input     string
+	s         scanner.Scanner
+	sourceMap *SourceMap
+	typed     map[string]TypedValue
+	positions map[string]Position
+
+	deprecations []Deprecation
+
+	constValues map[string]interface{}
+	collecting  bool
+
+	skipped []SkippedSpan
+
+	spans []tokenSpan
+
+	events EventHandler
+	// pending is a name of a definition that is not reported to events yet
+	pending string
 }
 
-func newParser(source string) *parser {
+func newParser(source string, opts ...ParserOption) *parser {
 	p := &parser{
-		source: source,
+		parserConfig: newParserConfig(opts),
+		source:       source,
 	}
 	p.s.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats | scanner.ScanStrings
 	return p
 }
 
 func (p *parser) Parse(tag string) ([]Definition, error) {
-	p.s.Init(strings.NewReader(tag))
 	result := []Definition{}
+	err := p.parse(tag, func(def Definition) error {
+		result = append(result, def)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parse parses a tag and calls emit for each definition.
+func (p *parser) parse(tag string, emit func(Definition) error) error {
+	p.spans = nil
+	if p.tokenizer != nil {
+		if p.sourceMap != nil {
+			return fmt.Errorf("source maps can not be used with WithTokenizer")
+		}
+		var err error
+		if tag, err = p.renderTokens(p.tokenizer(tag)); err != nil {
+			return err
+		}
+	}
+	if p.constants && p.constValues == nil {
+		p.collectConstants(tag)
+	}
+	p.input = tag
+	p.s.Init(strings.NewReader(tag))
+	if p.descriptionComments {
+		p.s.Mode &^= scanner.SkipComments
+	}
+	p.s.IsIdentRune = p.identRunes
+	if p.leadingSigil != 0 && p.skipWhitespace() == p.leadingSigil {
+		_ = p.s.Next()
+	}
+	description := ""
+	var names map[string]bool
+	if p.noDuplicates {
+		names = map[string]bool{}
+	}
+	tokens := &scannerTokenizer{p: p, strings: p.quotedNames}
 	for {
-		tok := p.s.Scan()
-		switch tok {
-		case scanner.EOF:
-			return result, nil
-		case scanner.Ident:
-			ident := p.s.TokenText()
-			if p.s.Peek() == '=' {
-				_ = p.s.Next()
-				value, err := p.parseValue()
-				if err != nil {
-					return nil, err
+		tok, err := tokens.Next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case tok.Kind == TokenEOF:
+			return nil
+		case tok.Kind == TokenIdent || tok.Kind == TokenString:
+			name := tok.Text
+			if len(name) == 0 {
+				return p.parseError("empty name")
+			}
+			start := p.s.Position.Offset
+			pos := p.s.Position
+			p.typed, p.positions = nil, nil
+			if p.events != nil {
+				p.pending = name
+			}
+			def, err := p.parseDefinition(name)
+			if err == nil && def != nil && p.trailingFlags {
+				err = p.parseTrailingFlags(def)
+			}
+			if err == nil && p.strict {
+				def, err = p.checkStrict(name, def)
+			}
+			if err == nil && p.strictCommas {
+				def, err = p.checkSeparated(name, def)
+			}
+			if err == nil && def != nil && names != nil {
+				if names[name] {
+					err = p.parseErrorAt(pos, fmt.Sprintf("duplicated definition: %s", name))
 				}
-				arg := map[string]interface{}{
-					ident: value,
+				names[name] = true
+			}
+			if err != nil {
+				if p.recover(err, start) {
+					description = ""
+					continue
 				}
-				result = append(result, newDefinition(ident, arg))
-			} else if p.s.Peek() == '(' {
-				_ = p.s.Next()
-				arg, err := p.parseArgs()
-				if err != nil {
-					return nil, err
+				return err
+			}
+			if def == nil {
+				continue
+			}
+			if p.constants && def.name == constDefinition {
+				for key, value := range def.attributes {
+					p.constValues[key] = value
 				}
-				result = append(result, newDefinition(ident, arg))
-			} else if p.s.Peek() == scanner.EOF || p.s.Peek() == ',' {
-				result = append(result, newDefinition(ident, map[string]interface{}{}))
+				description = ""
+				continue
+			}
+			p.finishDefinition(def, p.position(pos))
+			def.description = description
+			description = ""
+			if p.sourceMap != nil {
+				p.sourceMap.addDefinition(def, start, p.s.Pos().Offset)
+			}
+			if err := emit(def); err != nil {
+				return err
 			}
-		case ',':
-			// NOP
+		case tok.Kind == TokenComment:
+			description = commentText(tok.Text)
+		case tok.Kind == TokenPunct && tok.Text == string(p.separator):
+			// a trailing separator is also allowed
+			description = ""
 		default:
-			return nil, p.parseError(fmt.Sprintf("invalid token: %s", p.s.TokenText()))
+			if p.skipUnknown {
+				p.skipUnknownTokens(p.s.Position)
+				description = ""
+				continue
+			}
+			err := p.parseError(fmt.Sprintf("invalid token: %s", tok.Text))
+			if p.recover(err, p.s.Position.Offset) {
+				description = ""
+				continue
+			}
+			return err
+		}
+	}
+}
+
+// finishDefinition applies options that do not depend on the syntax to
+// a parsed definition at pos.
+func (p *parser) finishDefinition(def *definition, pos Position) {
+	if replacement, ok := p.deprecated[def.name]; ok {
+		p.deprecations = append(p.deprecations, Deprecation{
+			Name:        def.name,
+			Replacement: replacement,
+			Position:    pos,
+		})
+	}
+	def.typed = p.typed
+	def.pos, def.positions = pos, p.positions
+	for key, value := range p.defaultAttributes[def.name] {
+		if _, ok := def.attributes[key]; !ok {
+			def.attributes[key] = copyValue(value)
+		}
+	}
+}
+
+// copyValue returns a deep copy of arrays and objects in value, so
+// definitions do not share default values.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, e := range v {
+			array[i] = copyValue(e)
+		}
+		return array
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, e := range v {
+			object[key] = copyValue(e)
+		}
+		return object
+	}
+	return value
+}
+
+// checkStringMaxLen returns an error message if value of the named attribute
+// is longer than the limit set by WithStringMaxLen.
+func (p *parser) checkStringMaxLen(name string, value interface{}) (string, bool) {
+	limit, ok := p.stringMaxLen[name]
+	if str, isString := value.(string); ok && isString && utf8.RuneCountInString(str) > limit {
+		return fmt.Sprintf("'%s' must be at most %d characters", name, limit), false
+	}
+	return "", true
+}
+
+const constDefinition = "const"
+
+// collectConstants collects values of const definitions in the tag, so
+// constants can be referenced before they are defined.
+func (p *parser) collectConstants(tag string) {
+	pre := &parser{parserConfig: p.parserConfig, source: p.source}
+	pre.constValues, pre.collecting = map[string]interface{}{}, true
+	// tag is already rendered from tokens
+	pre.tokenizer = nil
+	// errors are reported by the following parse, so the pre-pass skips
+	// them without calling a callback set by WithRecover
+	pre.recoverFunc = func(ParseError) bool { return true }
+	_ = pre.parse(tag, func(Definition) error { return nil })
+	p.constValues = pre.constValues
+}
+
+// scanName scans the next token and returns it with its text. If
+// WithQuotedNames is enabled, a quoted string is scanned as an identifier.
+func (p *parser) scanName() (rune, string, error) {
+	if p.quotedNames {
+		if ch := p.skipWhitespace(); ch == '\'' || ch == '"' {
+			pos := p.s.Pos()
+			name, err := p.parseString(p.s.Next())
+			p.s.Position = pos
+			if err != nil {
+				return 0, "", err
+			}
+			if len(name) == 0 {
+				return 0, "", p.parseError("empty name")
+			}
+			return scanner.Ident, name, nil
+		}
+	}
+	tok := p.s.Scan()
+	return tok, p.s.TokenText(), nil
+}
+
+// checkStrict returns an error if the definition is not followed by
+// a separator or EOF. A name followed by whitespaces is a definition without
+// attributes.
+func (p *parser) checkStrict(name string, def *definition) (*definition, error) {
+	if ch := p.skipWhitespace(); ch != scanner.EOF && ch != p.separator {
+		_ = p.s.Scan()
+		return nil, p.parseError(fmt.Sprintf("%s expected but got %s", string(p.separator), p.s.TokenText()))
+	}
+	if def == nil {
+		def = newDefinition(name, map[string]interface{}{})
+	}
+	return def, nil
+}
+
+// checkSeparated returns an error if the definition is followed by another
+// definition without a separator.
+func (p *parser) checkSeparated(name string, def *definition) (*definition, error) {
+	ch := p.skipWhitespace()
+	if unicode.IsLetter(ch) || ch == '_' {
+		_ = p.s.Scan()
+		return nil, p.parseError(fmt.Sprintf("%s expected between %s and %s",
+			string(p.separator), name, p.s.TokenText()))
+	}
+	if def == nil && (ch == scanner.EOF || ch == p.separator) {
+		def = newDefinition(name, map[string]interface{}{})
+	}
+	return def, nil
+}
+
+// recover calls a callback given by WithRecover and skips to the next
+// separator if the callback returns true.
+func (p *parser) recover(err error, start int) bool {
+	perr, ok := err.(ParseError)
+	if p.recoverFunc == nil || !ok || !p.recoverFunc(perr) {
+		return false
+	}
+	if p.sourceMap != nil {
+		p.sourceMap.pending = p.sourceMap.pending[:0]
+	}
+	end := findSeparator(p.input, start, p.separator)
+	for p.s.Pos().Offset < end && p.s.Peek() != scanner.EOF {
+		_ = p.s.Next()
+	}
+	return true
+}
+
+// skipUnknownTokens skips tokens from pos to the next separator and records
+// them as a SkippedSpan.
+func (p *parser) skipUnknownTokens(pos scanner.Position) {
+	end := findSeparator(p.input, pos.Offset, p.separator)
+	for p.s.Pos().Offset < end && p.s.Peek() != scanner.EOF {
+		_ = p.s.Next()
+	}
+	p.skipped = append(p.skipped, SkippedSpan{
+		Text:     strings.TrimSpace(p.input[pos.Offset:end]),
+		Position: p.position(pos),
+	})
+}
+
+// findSeparator returns a byte offset of the first separator that is not
+// enclosed by brackets or quotes after from. findSeparator returns
+// len(s) if no separators are found.
+func findSeparator(s string, from int, sep rune) int {
+	depth := 0
+	var quote rune
+	escaped := false
+	for i, ch := range s[from:] {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if ch == '\\' {
+				escaped = true
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(' || ch == '[' || ch == '{':
+			depth++
+		case ch == ')' || ch == ']' || ch == '}':
+			if depth > 0 {
+				depth--
+			}
+		case ch == sep && depth == 0:
+			return from + i
+		}
+	}
+	return len(s)
+}
+
+// parseDefinition parses a definition that starts with the given name.
+// parseDefinition returns nil if the name is not followed by a valid
+// definition form.
+func (p *parser) parseDefinition(name string) (*definition, error) {
+	if p.followedBy("=(<") {
+		p.skipWhitespace()
+	}
+	if p.s.Peek() == '=' {
+		_ = p.s.Next()
+		value, err := p.parseAttributeValue(name)
+		if err != nil {
+			return nil, err
+		}
+		arg := map[string]interface{}{
+			name: value,
+		}
+		return newDefinition(name, arg), nil
+	} else if p.s.Peek() == '<' && p.nestedTags {
+		value, err := p.parseNested(p.s.Next())
+		if err != nil {
+			return nil, err
+		}
+		return newDefinition(name, map[string]interface{}{
+			name: value,
+		}), nil
+	} else if p.s.Peek() == '(' && p.rawDefinitions[name] {
+		_ = p.s.Next()
+		raw, err := p.parseRaw()
+		if err != nil {
+			return nil, err
+		}
+		def := newDefinition(name, map[string]interface{}{
+			name: raw,
+		})
+		def.parens = true
+		return def, nil
+	} else if p.s.Peek() == '(' && len(p.extends) != 0 && name == p.extends {
+		_ = p.s.Next()
+		fields, err := p.parseNames()
+		if err != nil {
+			return nil, err
+		}
+		arg := map[string]interface{}{
+			name: fields,
+		}
+		if len(fields) == 1 {
+			arg[name] = fields[0]
+		}
+		def := newDefinition(name, arg)
+		def.parens = true
+		return def, nil
+	} else if p.s.Peek() == '(' {
+		pos := p.s.Pos()
+		_ = p.s.Next()
+		arg, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		if p.indexedKeys {
+			arg, err = p.collapseIndexedKeys(arg, pos)
+			if err != nil {
+				return nil, err
+			}
+		}
+		def := newDefinition(name, arg)
+		def.parens = true
+		return def, nil
+	} else if p.s.Peek() == scanner.EOF || p.s.Peek() == p.separator || (p.trailingFlags && p.isWhitespace(p.s.Peek())) {
+		return newDefinition(name, map[string]interface{}{}), nil
+	}
+	return nil, nil
+}
+
+// parseTrailingFlags parses bare identifiers following a definition without
+// separators as flag attributes of the definition: type(email) required is
+// parsed as type(email, required=true).
+func (p *parser) parseTrailingFlags(def *definition) error {
+	for {
+		ch := p.skipWhitespace()
+		if !unicode.IsLetter(ch) && ch != '_' {
+			return nil
+		}
+		_ = p.s.Scan()
+		name := p.s.TokenText()
+		if next := p.s.Peek(); next == '=' || next == '(' {
+			return p.parseError(fmt.Sprintf("%s expected before %s", string(p.separator), name))
+		}
+		def.attributes[name] = true
+	}
+}
+
+func commentText(comment string) string {
+	if strings.HasPrefix(comment, "//") {
+		return strings.TrimSpace(comment[2:])
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(comment, "/*"), "*/"))
+}
+
+// lookahead returns the unread part of the input.
+func (p *parser) lookahead() string {
+	return p.input[p.s.Pos().Offset:]
+}
+
+// followedBy returns true if the unread input starts with one of chars,
+// a separator or EOF after whitespaces.
+func (p *parser) followedBy(chars string) bool {
+	la := strings.TrimLeftFunc(p.lookahead(), p.isWhitespace)
+	if len(la) == 0 {
+		return true
+	}
+	ch, _ := utf8.DecodeRuneInString(la)
+	return ch == p.separator || strings.ContainsRune(chars, ch)
+}
+
+// parseBareWord reads characters until a whitespace, a separator or
+// a closing bracket.
+func (p *parser) parseBareWord() string {
+	var buf bytes.Buffer
+	for ch := p.s.Peek(); ch != scanner.EOF && !p.isWhitespace(ch); ch = p.s.Peek() {
+		if ch == ',' || ch == p.separator || ch == ')' || ch == ']' || ch == '}' {
+			break
 		}
+		buf.WriteRune(p.s.Next())
+	}
+	return buf.String()
+}
+
+func (p *parser) isWhitespace(ch rune) bool {
+	return ch >= 0 && ch < 64 && p.s.Whitespace&(1<<uint(ch)) != 0
+}
+
+func (p *parser) skipWhitespace() rune {
+	ch := p.s.Peek()
+	for p.isWhitespace(ch) {
+		_ = p.s.Next()
+		ch = p.s.Peek()
 	}
+	return ch
 }
 
 func (p *parser) parseError(message string) error {
+	return p.parseErrorAt(p.s.Position, message)
+}
+
+func (p *parser) parseErrorAt(pos scanner.Position, message string) error {
+	position := p.position(pos)
 	return &parseError{
 		message: message,
-		column:  p.s.Position.Column,
-		line:    p.s.Position.Line,
+		source:  p.source,
+		column:  position.Column,
+		line:    position.Line,
+	}
+}
+
+// parseAttributeValue parses a value of the named attribute and records its
+// position. The value is also recorded as a TypedValue if WithTypedValues is
+// enabled.
+func (p *parser) parseAttributeValue(name string) (interface{}, error) {
+	p.skipWhitespace()
+	pos := p.s.Pos()
+	start := pos.Offset
+	value, err := p.parseValue()
+	if err != nil {
+		return value, err
+	}
+	if msg, ok := p.checkStringMaxLen(name, value); !ok {
+		return value, p.parseErrorAt(pos, msg)
+	}
+	if p.events != nil {
+		p.emitAttribute(name, value)
+		return value, nil
 	}
+	if p.positions == nil {
+		p.positions = map[string]Position{}
+	}
+	p.positions[name] = p.position(pos)
+	if !p.typedValues {
+		return value, nil
+	}
+	raw := strings.TrimSpace(p.input[start:p.s.Pos().Offset])
+	if p.typed == nil {
+		p.typed = map[string]TypedValue{}
+	}
+	p.typed[name] = TypedValue{Kind: valueKind(value, raw), Value: value, Raw: raw}
+	return value, nil
 }
 
 func (p *parser) parseValue() (interface{}, error) {
-	switch p.s.Peek() {
-	case '\'':
-		return p.parseString(p.s.Next())
+	p.skipWhitespace()
+	if p.placeholders && strings.HasPrefix(p.lookahead(), "${") {
+		return p.parsePlaceholder()
+	}
+	if p.fieldRefs && p.s.Peek() == '$' {
+		return p.parseFieldRef(p.s.Next())
+	}
+	if p.constants && p.skipWhitespace() == '@' {
+		return p.parseConstRef()
+	}
+	if p.pathValues && (p.s.Peek() == '/' || strings.HasPrefix(p.lookahead(), "./") ||
+		strings.HasPrefix(p.lookahead(), "../")) {
+		return p.parseBareWord(), nil
+	}
+	if p.goComposites && p.s.Peek() == '{' {
+		return p.parseComposite(p.s.Next())
+	}
+	if p.colorLiterals && p.s.Peek() == '#' {
+		return p.parseColor()
+	}
+	if p.macLiterals && isMACPrefix(p.lookahead()) {
+		return p.parseMAC()
+	}
+	if p.base64Literals && strings.HasPrefix(p.lookahead(), "b64:") {
+		return p.parseBase64()
+	}
+	if p.complexLiterals {
+		if lit := complexLiteral(p.lookahead()); len(lit) != 0 {
+			return p.parseComplex(lit)
+		}
+	}
+	if p.rateLiterals && isRatePrefix(p.lookahead()) {
+		return p.parseRate()
+	}
+	if p.uuidLiterals && isUUIDPrefix(p.lookahead()) {
+		return p.parseUUID()
+	}
+	if p.dashRanges && isDashRange(p.lookahead()) {
+		return p.parseDashRange()
+	}
+	if p.arithmetic {
+		if ch := p.skipWhitespace(); ch == '(' || ch == '-' || ch == '.' || unicode.IsDigit(ch) {
+			return p.parseExpr()
+		}
+	}
+	if p.nestedTags && p.skipWhitespace() == '<' {
+		return p.parseNested(p.s.Next())
+	}
+	switch p.skipWhitespace() {
+	case '\'', '"':
+		pos := p.s.Pos()
+		str, err := p.parseString(p.s.Next())
+		if err != nil {
+			return nil, err
+		}
+		if p.templateLiterals && strings.Contains(str, "{{") {
+			tmpl, err := template.New(p.source).Parse(str)
+			if err != nil {
+				return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid template: %s", err.Error()))
+			}
+			return tmpl, nil
+		}
+		return p.stringValue(str, pos)
 	case '[':
 		return p.parseArray(p.s.Next())
+	case '{':
+		return p.parseObject(p.s.Next())
 	default:
 		tok := p.s.Scan()
 		switch tok {
 		case scanner.Ident:
-			return p.s.TokenText(), nil
-		case scanner.String, scanner.Int, scanner.Float, '-':
+			return p.identValue(p.s.TokenText())
+		case scanner.Int, scanner.Float, '-':
 			mul := 1
 			if tok == '-' {
 				mul = -1
 				tok = p.s.Scan()
 			}
-			if tok == scanner.String {
-				str := p.s.TokenText()
-				return str[1 : len(str)-1], nil
-			} else if tok == scanner.Int {
-				v, err := strconv.ParseInt(p.s.TokenText(), 10, 64)
+			if tok == scanner.Int {
+				v, err := parseInt(p.s.TokenText())
 				if err != nil {
 					return nil, err
 				}
@@ -180,95 +721,928 @@ func (p *parser) parseValue() (interface{}, error) {
 		string([]rune{p.s.Peek()})))
 }
 
-func (p *parser) parseString(_ rune) (string, error) {
-	var buf bytes.Buffer
-	ch := p.s.Next()
-	for ch != '\'' {
-		if ch == '\n' || ch == '\r' || ch < 0 {
-			return "", p.parseError("unterminated string")
+// parseInt parses an integer literal. 0x, 0o and 0b prefixes are allowed, but
+// unlike Go, a leading 0 does not mean an octal number.
+func parseInt(s string) (int64, error) {
+	base := 10
+	if digits := strings.TrimPrefix(s, "-"); len(digits) > 1 && digits[0] == '0' &&
+		strings.ContainsRune("xXoObB", rune(digits[1])) {
+		base = 0
+	}
+	return strconv.ParseInt(s, base, 64)
+}
+
+// identValue converts an identifier in value context into a value.
+func (p *parser) identValue(ident string) (interface{}, error) {
+	switch ident {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if v, ok := p.boolAliases[ident]; ok {
+		return v, nil
+	}
+	if p.timezoneLiterals && (ident == "UTC" || p.s.Peek() == '/') {
+		return p.parseTimezone(ident)
+	}
+	if p.sliceRefs && p.s.Peek() == '[' {
+		return p.parseSliceRef(ident, p.s.Next())
+	}
+	return ident, nil
+}
+
+func (p *parser) parseSliceRef(name string, _ rune) (SliceRef, error) {
+	ref := SliceRef{Name: name}
+	index := func(end rune) (*int, error) {
+		ch := p.skipWhitespace()
+		if ch == end {
+			return nil, nil
 		}
-		if ch == '\\' {
-			s, err := p.parseEscape(ch)
-			if err != nil {
-				return "", err
-			}
-			buf.WriteString(s)
-		} else {
-			buf.WriteRune(ch)
+		mul := 1
+		if ch == '-' {
+			mul = -1
+			_ = p.s.Next()
 		}
-		ch = p.s.Next()
+		if p.s.Scan() != scanner.Int {
+			return nil, p.parseError(fmt.Sprintf("invalid index: %s", p.s.TokenText()))
+		}
+		v, err := strconv.Atoi(p.s.TokenText())
+		if err != nil {
+			return nil, p.parseError(fmt.Sprintf("invalid index: %s", p.s.TokenText()))
+		}
+		v *= mul
+		p.skipWhitespace()
+		return &v, nil
 	}
-	return buf.String(), nil
+	var err error
+	if ref.Low, err = index(':'); err != nil {
+		return ref, err
+	}
+	if colon := p.s.Next(); colon != ':' {
+		return ref, p.parseError(fmt.Sprintf(": expected but got %s", string(colon)))
+	}
+	if ref.High, err = index(']'); err != nil {
+		return ref, err
+	}
+	if next := p.s.Next(); next != ']' {
+		return ref, p.parseError(fmt.Sprintf("] expected but got %s", string(next)))
+	}
+	return ref, nil
 }
 
-func (p *parser) parseEscape(_ rune) (string, error) {
-	ch := p.s.Next()
-	switch ch {
-	case 'a':
-		return "\a", nil
-	case 'b':
-		return "\b", nil
-	case 'f':
-		return "\f", nil
-	case 'n':
-		return "\n", nil
-	case 'r':
-		return "\r", nil
-	case 't':
-		return "\t", nil
-	case 'v':
-		return "\v", nil
-	case '\\':
-		return "\\", nil
-	case '"':
-		return "\"", nil
-	case '\'':
-		return "'", nil
+// parseTimezone parses an IANA time zone name like America/New_York.
+func (p *parser) parseTimezone(prefix string) (*time.Location, error) {
+	pos := p.s.Position
+	var buf bytes.Buffer
+	buf.WriteString(prefix)
+	for ch := p.s.Peek(); isWordRune(ch) || strings.ContainsRune("+-/", ch); ch = p.s.Peek() {
+		buf.WriteRune(p.s.Next())
 	}
-	return "", p.parseError(fmt.Sprintf("invalid escape sequence: %s", string(ch)))
+	loc, err := time.LoadLocation(buf.String())
+	if err != nil {
+		return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid time zone: %s", buf.String()))
+	}
+	return loc, nil
 }
 
-func (p *parser) parseArray(_ rune) ([]interface{}, error) {
-	result := []interface{}{}
-	for {
-		value, err := p.parseValue()
+// stringValue converts a quoted string at pos into a value.
+func (p *parser) stringValue(str string, pos scanner.Position) (interface{}, error) {
+	if p.percentDecoding {
+		decoded, err := url.PathUnescape(str)
 		if err != nil {
-			return result, err
-		}
-		result = append(result, value)
-		next := p.s.Next()
-		if next == ']' {
-			return result, nil
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid percent encoding: %s", str))
 		}
-		if next == ',' {
-			continue
-		}
-		return result, p.parseError(fmt.Sprintf(", expected but got %s", string(next)))
+		return decoded, nil
 	}
+	return str, nil
 }
 
-func (p *parser) parseArgs() (map[string]interface{}, error) {
-	result := map[string]interface{}{}
+func (p *parser) parseFieldRef(_ rune) (FieldRef, error) {
+	ref := FieldRef{}
 	for {
-		tok := p.s.Scan()
-		if tok != scanner.Ident {
-			return result, p.parseError(fmt.Sprintf("invalid attribute name: %s", p.s.TokenText()))
-		}
-		name := p.s.TokenText()
-		eq := p.s.Next()
-		if eq != '=' {
-			return result, p.parseError(fmt.Sprintf("= expected but got %s", string(eq)))
-		}
-		value, err := p.parseValue()
-		if err != nil {
-			return result, err
+		ch := p.s.Peek()
+		if !unicode.IsLetter(ch) && ch != '_' {
+			return ref, p.parseError(fmt.Sprintf("invalid field reference: %s", string(ch)))
 		}
-		result[name] = value
-		next := p.s.Next()
-		if next == ')' {
-			return result, nil
+		_ = p.s.Scan()
+		ref.Path = append(ref.Path, p.s.TokenText())
+		if p.s.Peek() != '.' {
+			return ref, nil
 		}
-		if next == ',' {
+		_ = p.s.Next()
+	}
+}
+
+// parseConstRef parses an @NAME reference to a constant.
+func (p *parser) parseConstRef() (interface{}, error) {
+	pos := p.s.Pos()
+	_ = p.s.Next()
+	var buf bytes.Buffer
+	for ch := p.s.Peek(); isWordRune(ch); ch = p.s.Peek() {
+		buf.WriteRune(p.s.Next())
+	}
+	name := buf.String()
+	if len(name) == 0 {
+		return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid constant name: %s", string(p.s.Peek())))
+	}
+	value, ok := p.constValues[name]
+	if !ok && !p.collecting {
+		return nil, p.parseErrorAt(pos, fmt.Sprintf("undefined constant: %s", name))
+	}
+	return value, nil
+}
+
+// parsePlaceholder parses ${NAME} and ${NAME:-default} forms.
+func (p *parser) parsePlaceholder() (Placeholder, error) {
+	pos := p.s.Pos()
+	_, _ = p.s.Next(), p.s.Next()
+	ph := Placeholder{}
+	var buf bytes.Buffer
+	for ch := p.s.Peek(); isWordRune(ch); ch = p.s.Peek() {
+		buf.WriteRune(p.s.Next())
+	}
+	ph.Name = buf.String()
+	if len(ph.Name) == 0 {
+		return ph, p.parseErrorAt(pos, fmt.Sprintf("invalid placeholder name: %s", string(p.s.Peek())))
+	}
+	if strings.HasPrefix(p.lookahead(), ":-") {
+		_, _ = p.s.Next(), p.s.Next()
+		buf.Reset()
+		for ch := p.s.Peek(); ch != '}' && ch != scanner.EOF; ch = p.s.Peek() {
+			buf.WriteRune(p.s.Next())
+		}
+		ph.Default = buf.String()
+		ph.HasDefault = true
+	}
+	if next := p.s.Next(); next != '}' {
+		return ph, p.parseErrorAt(pos, fmt.Sprintf("} expected but got %s", string(next)))
+	}
+	return ph, nil
+}
+
+// parseObject parses an object literal like {key=value, ...}.
+func (p *parser) parseObject(_ rune) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	if p.skipWhitespace() == '}' {
+		_ = p.s.Next()
+		return result, nil
+	}
+	for {
+		if tok := p.s.Scan(); tok != scanner.Ident {
+			return result, p.parseError(fmt.Sprintf("invalid key: %s", p.s.TokenText()))
+		}
+		name := p.s.TokenText()
+		p.skipWhitespace()
+		if eq := p.s.Next(); eq != '=' {
+			return result, p.parseError(fmt.Sprintf("= expected but got %s", string(eq)))
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return result, err
+		}
+		result[name] = value
+		p.skipWhitespace()
+		next := p.s.Next()
+		if next == '}' {
+			return result, nil
+		}
+		if next == ',' {
+			continue
+		}
+		return result, p.parseError(fmt.Sprintf("} or , expected but got %s", string(next)))
+	}
+}
+
+func (p *parser) parseComposite(_ rune) (CompositeLit, error) {
+	result := CompositeLit{Fields: map[string]interface{}{}}
+	if p.skipWhitespace() == '}' {
+		_ = p.s.Next()
+		return result, nil
+	}
+	for {
+		tok := p.s.Scan()
+		if tok != scanner.Ident {
+			return result, p.parseError(fmt.Sprintf("invalid field name: %s", p.s.TokenText()))
+		}
+		name := p.s.TokenText()
+		p.skipWhitespace()
+		if colon := p.s.Next(); colon != ':' {
+			return result, p.parseError(fmt.Sprintf(": expected but got %s", string(colon)))
+		}
+		p.skipWhitespace()
+		value, err := p.parseValue()
+		if err != nil {
+			return result, err
+		}
+		result.Fields[name] = value
+		p.skipWhitespace()
+		next := p.s.Next()
+		if next == '}' {
+			return result, nil
+		}
+		if next == ',' {
+			continue
+		}
+		return result, p.parseError(fmt.Sprintf("} or , expected but got %s", string(next)))
+	}
+}
+
+// parseColor parses #RGB, #RRGGBB and #RRGGBBAA forms.
+func (p *parser) parseColor() (Color, error) {
+	pos := p.s.Pos()
+	_ = p.s.Next()
+	var digits []rune
+	for ch := p.s.Peek(); unicode.IsLetter(ch) || unicode.IsDigit(ch); ch = p.s.Peek() {
+		v, ok := hexValue(p.s.Next())
+		if !ok {
+			return Color{}, p.parseErrorAt(pos, fmt.Sprintf("invalid color: %s", string(ch)))
+		}
+		digits = append(digits, v)
+	}
+	c := Color{A: 255}
+	switch len(digits) {
+	case 3:
+		c.R, c.G, c.B = uint8(digits[0]*17), uint8(digits[1]*17), uint8(digits[2]*17)
+	case 6, 8:
+		c.R = uint8(digits[0]<<4 | digits[1])
+		c.G = uint8(digits[2]<<4 | digits[3])
+		c.B = uint8(digits[4]<<4 | digits[5])
+		if len(digits) == 8 {
+			c.A = uint8(digits[6]<<4 | digits[7])
+		}
+	default:
+		return c, p.parseErrorAt(pos, fmt.Sprintf("invalid color: %d hex digits", len(digits)))
+	}
+	return c, nil
+}
+
+// isMACPrefix returns true if s starts with two hex digits followed by ':'.
+func isMACPrefix(s string) bool {
+	if len(s) < 3 || s[2] != ':' {
+		return false
+	}
+	_, ok1 := hexValue(rune(s[0]))
+	_, ok2 := hexValue(rune(s[1]))
+	return ok1 && ok2
+}
+
+// parseMAC parses a MAC address of six colon separated groups of two hex
+// digits like 00:1A:2B:3C:4D:5E.
+func (p *parser) parseMAC() (net.HardwareAddr, error) {
+	p.skipWhitespace()
+	pos := p.s.Pos()
+	var buf bytes.Buffer
+	for ch := p.s.Peek(); ch == ':' || isWordRune(ch); ch = p.s.Peek() {
+		buf.WriteRune(p.s.Next())
+	}
+	groups := strings.Split(buf.String(), ":")
+	if len(groups) != 6 {
+		return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid MAC address: %s", buf.String()))
+	}
+	addr := make(net.HardwareAddr, 0, len(groups))
+	for _, g := range groups {
+		if len(g) != 2 {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid MAC address: %s", buf.String()))
+		}
+		hi, ok1 := hexValue(rune(g[0]))
+		lo, ok2 := hexValue(rune(g[1]))
+		if !ok1 || !ok2 {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid MAC address: %s", buf.String()))
+		}
+		addr = append(addr, byte(hi<<4|lo))
+	}
+	return addr, nil
+}
+
+// complexLiteral returns a complex number literal like 3+4i at the start of s
+// or an empty string.
+func complexLiteral(s string) string {
+	n := len(s) - len(strings.TrimLeft(s, "0123456789.eE+-_i"))
+	lit := s[:n]
+	if !strings.HasSuffix(lit, "i") || (n < len(s) && isWordRune(rune(s[n]))) ||
+		!strings.ContainsAny(lit[:1], "0123456789.+-") {
+		return ""
+	}
+	return lit
+}
+
+// parseComplex parses a complex number literal given by complexLiteral.
+func (p *parser) parseComplex(lit string) (complex128, error) {
+	p.skipWhitespace()
+	pos := p.s.Pos()
+	for range lit {
+		_ = p.s.Next()
+	}
+	v, err := strconv.ParseComplex(lit, 128)
+	if err != nil {
+		return 0, p.parseErrorAt(pos, fmt.Sprintf("invalid complex number: %s", lit))
+	}
+	return v, nil
+}
+
+// isDashRange returns true if s starts with a range like 18-65.
+func isDashRange(s string) bool {
+	lo := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	if lo == 0 || lo == len(s) || s[lo] != '-' {
+		return false
+	}
+	rest := s[lo+1:]
+	hi := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+	if hi == 0 {
+		return false
+	}
+	return hi == len(rest) || !isWordRune(rune(rest[hi])) && rest[hi] != '.'
+}
+
+// parseDashRange parses a range like 18-65. The lower bound must not be
+// greater than the upper bound.
+func (p *parser) parseDashRange() (Range, error) {
+	p.skipWhitespace()
+	pos := p.s.Pos()
+	var r Range
+	for i, dst := range []*int64{&r.Lo, &r.Hi} {
+		if i != 0 {
+			_ = p.s.Next()
+		}
+		var buf bytes.Buffer
+		for ch := p.s.Peek(); '0' <= ch && ch <= '9'; ch = p.s.Peek() {
+			buf.WriteRune(p.s.Next())
+		}
+		v, err := strconv.ParseInt(buf.String(), 10, 64)
+		if err != nil {
+			return r, p.parseErrorAt(pos, fmt.Sprintf("invalid range: %s", err.Error()))
+		}
+		*dst = v
+	}
+	if r.Lo > r.Hi {
+		return r, p.parseErrorAt(pos, fmt.Sprintf("invalid range: %d is greater than %d", r.Lo, r.Hi))
+	}
+	return r, nil
+}
+
+// isUUIDPrefix returns true if s starts with eight hex digits followed
+// by '-'.
+func isUUIDPrefix(s string) bool {
+	if len(s) < 9 || s[8] != '-' {
+		return false
+	}
+	for _, ch := range s[:8] {
+		if _, ok := hexValue(ch); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUUID parses a UUID in the canonical 8-4-4-4-12 form.
+func (p *parser) parseUUID() (UUID, error) {
+	p.skipWhitespace()
+	pos := p.s.Pos()
+	var buf bytes.Buffer
+	for ch := p.s.Peek(); ch == '-' || isWordRune(ch); ch = p.s.Peek() {
+		buf.WriteRune(p.s.Next())
+	}
+	raw := buf.String()
+	var u UUID
+	if len(raw) != 36 {
+		return u, p.parseErrorAt(pos, fmt.Sprintf("invalid UUID: %s", raw))
+	}
+	for i, j := 0, 0; i < len(raw); i++ {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if raw[i] != '-' {
+				return u, p.parseErrorAt(pos, fmt.Sprintf("invalid UUID: %s", raw))
+			}
+			continue
+		}
+		v, ok := hexValue(rune(raw[i]))
+		if !ok {
+			return u, p.parseErrorAt(pos, fmt.Sprintf("invalid UUID: %s", raw))
+		}
+		u[j/2] |= byte(v) << (4 * (1 - j%2))
+		j++
+	}
+	return u, nil
+}
+
+// isRatePrefix returns true if s starts with a byte size followed by '/'.
+func isRatePrefix(s string) bool {
+	n := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	i := strings.IndexByte(s, '/')
+	if n == 0 || i < n {
+		return false
+	}
+	_, ok := sizeUnit(s[n:i])
+	return ok
+}
+
+func sizeUnit(name string) (int64, bool) {
+	for _, unit := range sizeUnits {
+		if unit.name == name {
+			return unit.size, true
+		}
+	}
+	return 0, false
+}
+
+// parseRate parses a rate like 10MB/s and 1GiB/5m. A duration without
+// a number means a single unit of time.
+func (p *parser) parseRate() (Rate, error) {
+	p.skipWhitespace()
+	pos := p.s.Pos()
+	var buf bytes.Buffer
+	for ch := p.s.Peek(); isWordRune(ch) || ch == '/' || ch == '.'; ch = p.s.Peek() {
+		buf.WriteRune(p.s.Next())
+	}
+	raw := buf.String()
+	size, per, _ := strings.Cut(raw, "/")
+	n := len(size) - len(strings.TrimLeft(size, "0123456789"))
+	unit, _ := sizeUnit(size[n:])
+	count, err := strconv.ParseInt(size[:n], 10, 64)
+	if err != nil || count > math.MaxInt64/unit {
+		return Rate{}, p.parseErrorAt(pos, fmt.Sprintf("invalid rate: %s", raw))
+	}
+	if len(per) != 0 && !unicode.IsDigit(rune(per[0])) {
+		per = "1" + per
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Rate{}, p.parseErrorAt(pos, fmt.Sprintf("invalid rate: %s", raw))
+	}
+	return Rate{Bytes: count * unit, Per: d}, nil
+}
+
+// parseNested parses nested tags like <Name:required,max=10, Age:min=0>.
+// A new field starts at a separator followed by a field name and a colon.
+func (p *parser) parseNested(_ rune) (map[string][]Definition, error) {
+	base := p.s.Pos().Offset
+	var buf bytes.Buffer
+	depth := 0
+	var quote rune
+	for {
+		ch := p.s.Next()
+		if ch == scanner.EOF {
+			return nil, p.parseError("unterminated nested tags")
+		}
+		if quote != 0 {
+			if ch == '\\' {
+				buf.WriteRune(ch)
+				ch = p.s.Next()
+			} else if ch == quote {
+				quote = 0
+			}
+		} else if ch == '\'' || ch == '"' {
+			quote = ch
+		} else if ch == '<' {
+			depth++
+		} else if ch == '>' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		buf.WriteRune(ch)
+	}
+	s := buf.String()
+	result := map[string][]Definition{}
+	var field, rules string
+	// rulesStart is a byte offset of rules in s
+	rulesStart := 0
+	flush := func() error {
+		if len(field) == 0 {
+			return nil
+		}
+		sub := &parser{parserConfig: p.parserConfig, source: p.source + "." + field}
+		sub.tokenizer = nil
+		defs, err := sub.Parse(rules)
+		if perr, ok := err.(*parseError); ok {
+			return p.offsetError(perr, base+rulesStart)
+		}
+		if err != nil {
+			return err
+		}
+		result[field] = defs
+		return nil
+	}
+	for start := 0; start < len(s); {
+		end := findSeparator(s, start, p.separator)
+		segment := s[start:end]
+		segmentStart := start
+		start = end + 1
+		if name, rest, ok := strings.Cut(segment, ":"); ok && isSimpleIdent(strings.TrimSpace(name)) {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			field, rules = strings.TrimSpace(name), rest
+			rulesStart = segmentStart + len(name) + 1
+			continue
+		}
+		if len(field) == 0 {
+			return nil, p.parseError(fmt.Sprintf("field name expected but got %s", strings.TrimSpace(segment)))
+		}
+		rules += string(p.separator) + segment
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// offsetError converts a position of perr in a part of the input that starts
+// at the byte offset into a position in the input.
+func (p *parser) offsetError(perr *parseError, offset int) error {
+	before := p.input[:offset]
+	pos := scanner.Position{
+		Offset: offset,
+		Line:   strings.Count(before, "\n") + perr.line,
+		Column: perr.column,
+	}
+	if perr.line <= 1 {
+		// the error is on the line where the part starts
+		pos.Line = strings.Count(before, "\n") + 1
+		pos.Column += utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:])
+		pos.Offset += perr.column - 1
+	}
+	position := p.position(pos)
+	perr.line, perr.column = position.Line, position.Column
+	return perr
+}
+
+// parseBase64 parses a base64 encoded binary like b64:SGVsbG8=.
+func (p *parser) parseBase64() ([]byte, error) {
+	pos := p.s.Pos()
+	for i := 0; i < len("b64:"); i++ {
+		_ = p.s.Next()
+	}
+	data, err := base64.StdEncoding.DecodeString(p.parseBareWord())
+	if err != nil {
+		return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid base64: %s", err.Error()))
+	}
+	return data, nil
+}
+
+// parseString parses a string enclosed by quote.
+func (p *parser) parseString(quote rune) (string, error) {
+	var buf bytes.Buffer
+	ch := p.s.Next()
+	for ch != quote {
+		if ch == '\n' || ch == '\r' || ch < 0 {
+			return "", p.parseError("unterminated string")
+		}
+		if ch == '\\' {
+			s, err := p.parseEscape(ch)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(s)
+		} else {
+			buf.WriteRune(ch)
+		}
+		ch = p.s.Next()
+	}
+	return buf.String(), nil
+}
+
+func (p *parser) parseEscape(_ rune) (string, error) {
+	ch := p.s.Next()
+	switch ch {
+	case 'a':
+		return "\a", nil
+	case 'b':
+		return "\b", nil
+	case 'f':
+		return "\f", nil
+	case 'n':
+		return "\n", nil
+	case 'r':
+		return "\r", nil
+	case 't':
+		return "\t", nil
+	case 'v':
+		return "\v", nil
+	case '\\':
+		return "\\", nil
+	case '"':
+		return "\"", nil
+	case '\'':
+		return "'", nil
+	case 'x':
+		return p.parseHexEscape(ch, 2)
+	case 'u':
+		return p.parseHexEscape(ch, 4)
+	case 'U':
+		return p.parseHexEscape(ch, 8)
+	}
+	return "", p.parseError(fmt.Sprintf("invalid escape sequence: %s", string(ch)))
+}
+
+// parseHexEscape parses n hex digits following an escape character like
+// \xHH, \uHHHH and \UHHHHHHHH. The value is interpreted as a unicode
+// code point, so \xFF yields the rune U+00FF rather than a raw 0xFF byte.
+func (p *parser) parseHexEscape(prefix rune, n int) (string, error) {
+	var r rune
+	for i := 0; i < n; i++ {
+		pos := p.s.Pos()
+		ch := p.s.Next()
+		v, ok := hexValue(ch)
+		if !ok {
+			return "", p.parseErrorAt(pos, fmt.Sprintf("invalid escape sequence: %s%s", string(prefix), string(ch)))
+		}
+		r = r<<4 | v
+	}
+	if !utf8.ValidRune(r) {
+		return "", p.parseError(fmt.Sprintf("invalid escape sequence: %s%x", string(prefix), r))
+	}
+	return string(r), nil
+}
+
+func isWordRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+}
+
+func hexValue(ch rune) (rune, bool) {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return ch - '0', true
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10, true
+	case 'A' <= ch && ch <= 'F':
+		return ch - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (p *parser) parseArray(_ rune) ([]interface{}, error) {
+	result := []interface{}{}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return result, err
+		}
+		result = append(result, value)
+		p.skipWhitespace()
+		next := p.s.Next()
+		if next == ']' {
+			if p.arrayDedup {
+				result = dedupValues(result)
+			}
+			return result, nil
+		}
+		if next == ',' {
+			continue
+		}
+		return result, p.parseError(fmt.Sprintf(", expected but got %s", string(next)))
+	}
+}
+
+// dedupValues removes duplicated values preserving first occurrences.
+// Values of different types are never equal.
+func dedupValues(values []interface{}) []interface{} {
+	result := values[:0]
+	for _, value := range values {
+		found := false
+		for _, v := range result {
+			if reflect.DeepEqual(v, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func (p *parser) parseArgs() (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	if p.skipWhitespace() == ')' {
+		_ = p.s.Next()
+		return result, nil
+	}
+	named, positional := false, false
+	for {
+		var name string
+		var start int
+		if p.positionalArgs && !p.isNamedArg() {
+			if named {
+				p.s.Scan()
+				return result, p.parseError("positional and named attributes can not be mixed")
+			}
+			positional = true
+			p.skipWhitespace()
+			start = p.s.Pos().Offset
+			value, err := p.parseValue()
+			if err != nil {
+				return result, err
+			}
+			name = PositionalArgs
+			args, _ := result[name].([]interface{})
+			result[name] = append(args, value)
+		} else {
+			if positional {
+				p.s.Scan()
+				return result, p.parseError("positional and named attributes can not be mixed")
+			}
+			named = true
+			var err error
+			name, start, err = p.parseNamedArg(result)
+			if err != nil {
+				return result, err
+			}
+		}
+		if p.sourceMap != nil {
+			p.sourceMap.addAttribute(name, start, p.s.Pos().Offset)
+		}
+		if !p.spaceArgs {
+			p.skipWhitespace()
+		}
+		next := p.s.Next()
+		if p.spaceArgs && p.isWhitespace(next) {
+			if ch := p.skipWhitespace(); ch != ')' && ch != ',' {
+				continue
+			}
+			next = p.s.Next()
+		}
+		if next == ')' {
+			return result, nil
+		}
+		if next == ',' {
+			continue
+		}
+		return result, p.parseError(fmt.Sprintf(") or , expected but got %s", string(next)))
+	}
+}
+
+// parseNamedArg parses an attribute like name=value and sets it to result.
+// parseNamedArg returns the name and the start offset of the attribute.
+func (p *parser) parseNamedArg(result map[string]interface{}) (string, int, error) {
+	tok, name, err := p.scanName()
+	start := p.s.Position.Offset
+	negate := false
+	if err == nil && tok == '!' && p.flagArgs {
+		negate = true
+		tok, name, err = p.scanName()
+	}
+	if err != nil {
+		return "", start, err
+	}
+	if tok != scanner.Ident {
+		return "", start, p.parseError(fmt.Sprintf("invalid attribute name: %s", p.s.TokenText()))
+	}
+	if _, ok := result[name]; ok && p.noDuplicates {
+		return "", start, p.parseError(fmt.Sprintf("duplicated attribute: %s", name))
+	}
+	if p.flagArgs && (negate || !strings.HasPrefix(strings.TrimLeftFunc(p.lookahead(), p.isWhitespace), "=")) {
+		result[name] = !negate
+		return name, start, nil
+	}
+	p.skipWhitespace()
+	eq := p.s.Next()
+	if eq != '=' {
+		return "", start, p.parseError(fmt.Sprintf("= expected but got %s", string(eq)))
+	}
+	value, err := p.parseAttributeValue(name)
+	if err != nil {
+		return "", start, err
+	}
+	result[name] = value
+	return name, start, nil
+}
+
+// isNamedArg returns true if the unread input starts with name=.
+func (p *parser) isNamedArg() bool {
+	la := strings.TrimLeftFunc(p.lookahead(), p.isWhitespace)
+	for i, ch := range la {
+		if !isWordRune(ch) {
+			return i > 0 && ch == '='
+		}
+	}
+	return false
+}
+
+// maxKeyIndex is the largest index collapseIndexedKeys accepts, which bounds
+// the size of arrays allocated for sparse indices.
+const maxKeyIndex = 1024
+
+// collapseIndexedKeys collapses indexed keys in args of an argument list
+// starting at pos.
+func (p *parser) collapseIndexedKeys(args map[string]interface{},
+	pos scanner.Position) (map[string]interface{}, error) {
+	indexed := map[string]map[int]string{}
+	for key := range args {
+		i := len(key)
+		for i > 0 && key[i-1] >= '0' && key[i-1] <= '9' {
+			i--
+		}
+		if i == 0 || i == len(key) {
+			continue
+		}
+		index, err := strconv.Atoi(key[i:])
+		if err != nil {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("invalid index: %s", key))
+		}
+		if index > maxKeyIndex {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("index too large: %s", key))
+		}
+		prefix := key[:i]
+		if _, ok := indexed[prefix]; !ok {
+			indexed[prefix] = map[int]string{}
+		}
+		if _, ok := indexed[prefix][index]; ok {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("duplicated index: %s", key))
+		}
+		indexed[prefix][index] = key
+	}
+	prefixes := make([]string, 0, len(indexed))
+	for prefix, keys := range indexed {
+		if len(keys) < 2 {
+			// a lone numbered key such as utf8 is a plain attribute
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	result := map[string]interface{}{}
+	for key, value := range args {
+		result[key] = value
+	}
+	for _, prefix := range prefixes {
+		if _, ok := args[prefix]; ok {
+			return nil, p.parseErrorAt(pos, fmt.Sprintf("%s conflicts with indexed keys", prefix))
+		}
+		keys := indexed[prefix]
+		last := -1
+		for index := range keys {
+			if index > last {
+				last = index
+			}
+		}
+		array := make([]interface{}, last+1)
+		for index := range array {
+			key, ok := keys[index]
+			if !ok {
+				if !p.indexedKeyGaps {
+					return nil, p.parseErrorAt(pos, fmt.Sprintf("missing index: %s%d", prefix, index))
+				}
+				continue
+			}
+			array[index] = args[key]
+			delete(result, key)
+		}
+		result[prefix] = array
+	}
+	return result, nil
+}
+
+// parseRaw reads characters until a closing parenthesis that balances
+// the consumed opening parenthesis.
+func (p *parser) parseRaw() (string, error) {
+	var buf bytes.Buffer
+	depth := 0
+	var quote rune
+	for {
+		ch := p.s.Next()
+		switch {
+		case ch == scanner.EOF:
+			return "", p.parseError(") expected but got EOF")
+		case quote != 0:
+			if ch == '\\' {
+				buf.WriteRune(ch)
+				ch = p.s.Next()
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth == 0 {
+				return buf.String(), nil
+			}
+			depth--
+		}
+		buf.WriteRune(ch)
+	}
+}
+
+func (p *parser) parseNames() ([]interface{}, error) {
+	result := []interface{}{}
+	for {
+		tok := p.s.Scan()
+		if tok != scanner.Ident {
+			return result, p.parseError(fmt.Sprintf("invalid name: %s", p.s.TokenText()))
+		}
+		result = append(result, p.s.TokenText())
+		next := p.s.Next()
+		if next == ')' {
+			return result, nil
+		}
+		if next == ',' {
 			continue
 		}
 		return result, p.parseError(fmt.Sprintf(") or , expected but got %s", string(next)))
@@ -277,29 +1651,549 @@ func (p *parser) parseArgs() (map[string]interface{}, error) {
 
 // ParseTag parses a given tag value.
 func ParseTag(value string, name string) ([]Definition, error) {
-	p := newParser(name)
+	return ParseTagWithOptions(value, name)
+}
+
+// ParseTagWithOptions parses a given tag value with options.
+func ParseTagWithOptions(value string, name string, opts ...ParserOption) ([]Definition, error) {
+	if len(opts) == 0 {
+		if defs, ok := parseSimple(value); ok {
+			return defs, nil
+		}
+	}
+	p := newParser(name, opts...)
 	return p.Parse(value)
 }
 
+// simpleResult holds a definition and a slice of it in a single allocation.
+type simpleResult struct {
+	def  definition
+	defs [1]Definition
+}
+
+// parseSimple parses common simple tags like 'required' and 'max=10' without
+// the scanner. parseSimple returns false if the tag is not simple.
+// parseSimple allocates only a result, an attribute map and a boxed int64.
+func parseSimple(value string) ([]Definition, bool) {
+	name, num, hasValue := strings.Cut(value, "=")
+	if !isSimpleIdent(name) {
+		return nil, false
+	}
+	var v int64
+	if hasValue {
+		digits := strings.TrimPrefix(num, "-")
+		if len(digits) == 0 || strings.TrimLeft(digits, "0123456789") != "" {
+			return nil, false
+		}
+		var err error
+		if v, err = strconv.ParseInt(num, 10, 64); err != nil {
+			return nil, false
+		}
+	}
+	r := &simpleResult{}
+	r.def = definition{
+		name:       name,
+		attributes: make(map[string]interface{}, 1),
+		pos:        Position{Line: 1, Column: 1},
+		simple:     true,
+	}
+	if hasValue {
+		r.def.attributes[name] = v
+	}
+	r.defs[0] = &r.def
+	return r.defs[:], true
+}
+
+func isSimpleIdent(s string) bool {
+	if len(s) == 0 || ('0' <= s[0] && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Deprecation is a use of a deprecated definition.
+type Deprecation struct {
+	// Name is a name of the deprecated definition
+	Name string
+	// Replacement is a hint given by WithDeprecated
+	Replacement string
+	// Position is a position of the definition
+	Position Position
+}
+
+// SkippedSpan is a part of a tag value skipped by WithSkipUnknown.
+type SkippedSpan struct {
+	// Text is the skipped text without surrounding spaces
+	Text string
+	// Position is a position of the first skipped token
+	Position Position
+}
+
+// Parser parses tag values with options and keeps reports of the last
+// parse. Parser is not safe for concurrent use.
+type Parser struct {
+	opts         []ParserOption
+	deprecations []Deprecation
+	skipped      []SkippedSpan
+}
+
+// NewParser returns a new Parser with options.
+func NewParser(opts ...ParserOption) *Parser {
+	return &Parser{opts: opts}
+}
+
+// Parse parses a given tag value. name is used as a source name of errors.
+func (p *Parser) Parse(value string, name string) ([]Definition, error) {
+	pr := newParser(name, p.opts...)
+	defs, err := pr.Parse(value)
+	p.deprecations, p.skipped = pr.deprecations, pr.skipped
+	return defs, err
+}
+
+// Deprecations returns uses of definitions deprecated by WithDeprecated in
+// the last parse.
+func (p *Parser) Deprecations() []Deprecation {
+	return p.deprecations
+}
+
+// Skipped returns parts of the tag value skipped by WithSkipUnknown in
+// the last parse.
+func (p *Parser) Skipped() []SkippedSpan {
+	return p.skipped
+}
+
+// ParseTagFunc parses a given tag value and calls fn for each definition
+// without collecting them. If fn returns an error, ParseTagFunc stops parsing
+// and returns the error.
+func ParseTagFunc(value string, name string, fn func(Definition) error) error {
+	return newParser(name).parse(value, fn)
+}
+
+// ParseTagStrict is like ParseTag, but returns an error instead of dropping
+// tokens that do not form a definition like min=1 in 'required min=1'.
+// Duplicated definitions and attributes are also errors.
+func ParseTagStrict(value string, name string) ([]Definition, error) {
+	return ParseTagWithOptions(value, name, WithStrict(), WithNoDuplicates())
+}
+
+// ParseSingle parses a given tag value that must consist of exactly one definition.
+func ParseSingle(value string, name string) (Definition, error) {
+	defs, err := ParseTag(value, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(defs) != 1 {
+		return nil, fmt.Errorf("%s: a single definition expected but got %d", name, len(defs))
+	}
+	return defs[0], nil
+}
+
+// ParseLines parses each line of r as an independent tag value.
+// Blank lines and lines starting with '#' are skipped.
+// Line numbers of errors are line numbers in r.
+func ParseLines(r io.Reader, name string) ([][]Definition, error) {
+	result := [][]Definition{}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		defs, err := ParseTag(s.Text(), name)
+		if err != nil {
+			if perr, ok := err.(*parseError); ok {
+				perr.line = line
+			}
+			return nil, err
+		}
+		result = append(result, defs)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // ParseStruct parses struct tags of given object. map key is a field name.
 func ParseStruct(obj interface{}, tag string) (map[string][]Definition, error) {
+	return ParseStructWithOptions(obj, tag)
+}
+
+// MustParseStruct is like ParseStruct but panics if tags can not be parsed.
+// It simplifies safe initialization of global variables.
+func MustParseStruct(obj interface{}, tag string) map[string][]Definition {
+	result, err := ParseStruct(obj, tag)
+	if err != nil {
+		panic(fmt.Sprintf("stagparser: failed to parse '%s' tags of %T: %s", tag, obj, err.Error()))
+	}
+	return result
+}
+
+// ParseStructWithOptions parses struct tags of given object with options.
+// map key is a field name.
+func ParseStructWithOptions(obj interface{}, tag string, opts ...ParserOption) (map[string][]Definition, error) {
 	result := map[string][]Definition{}
 	r := reflect.ValueOf(obj)
 	if r.Kind() == reflect.Ptr {
 		obj = r.Elem().Interface()
 	}
 	rv := reflect.TypeOf(obj)
-	for i := 0; i < rv.NumField(); i++ {
-		f := rv.Field(i)
+	for _, f := range structFields(rv, []string{tag}) {
 		value := f.Tag.Get(tag)
 		if len(value) == 0 {
 			continue
 		}
-		defs, err := ParseTag(value, rv.Name()+"."+f.Name)
+		defs, err := ParseTagWithOptions(value, rv.Name()+"."+f.Name, opts...)
 		if err != nil {
 			return nil, err
 		}
 		result[f.Name] = defs
 	}
+	if c := newParserConfig(opts); len(c.extends) != 0 {
+		return resolveExtends(result, c.extends, rv.Name())
+	}
+	return result, nil
+}
+
+// FieldDefinitions is definitions of a struct field.
+type FieldDefinitions struct {
+	// Name is a field name
+	Name string
+	// Definitions are definitions parsed from the tag
+	Definitions []Definition
+}
+
+// ParseStructOrdered is like ParseStruct, but returns definitions in
+// field declaration order. Fields promoted from embedded structs are placed
+// at the position of the embedded struct.
+func ParseStructOrdered(obj interface{}, tag string) ([]FieldDefinitions, error) {
+	r := reflect.ValueOf(obj)
+	if r.Kind() == reflect.Ptr {
+		obj = r.Elem().Interface()
+	}
+	rv := reflect.TypeOf(obj)
+	var result []FieldDefinitions
+	for _, f := range structFields(rv, []string{tag}) {
+		value := f.Tag.Get(tag)
+		if len(value) == 0 {
+			continue
+		}
+		defs, err := ParseTag(value, rv.Name()+"."+f.Name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, FieldDefinitions{Name: f.Name, Definitions: defs})
+	}
+	return result, nil
+}
+
+// structFields returns fields of t in declaration order, including fields
+// promoted from embedded structs that do not have any of the tags. If tags
+// is empty, embedded structs with any tags are not promoted. As in Go,
+// a shallower field hides deeper fields with the same name and fields with
+// the same name at the same depth hide each other.
+func structFields(t reflect.Type, tags []string) []reflect.StructField {
+	type entry struct {
+		field reflect.StructField
+		depth int
+	}
+	var entries []entry
+	visiting := map[reflect.Type]bool{}
+	var walk func(t reflect.Type, depth int)
+	walk = func(t reflect.Type, depth int) {
+		visiting[t] = true
+		defer delete(visiting, t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && ft.Kind() == reflect.Struct && !hasTag(f.Tag, tags) {
+				if !visiting[ft] {
+					walk(ft, depth+1)
+				}
+				continue
+			}
+			entries = append(entries, entry{field: f, depth: depth})
+		}
+	}
+	walk(t, 0)
+
+	depths := map[string]int{}
+	counts := map[string]int{}
+	for _, e := range entries {
+		d, ok := depths[e.field.Name]
+		if !ok || e.depth < d {
+			depths[e.field.Name] = e.depth
+			counts[e.field.Name] = 1
+		} else if e.depth == d {
+			counts[e.field.Name]++
+		}
+	}
+	result := make([]reflect.StructField, 0, len(entries))
+	for _, e := range entries {
+		if depths[e.field.Name] == e.depth && counts[e.field.Name] == 1 {
+			result = append(result, e.field)
+		}
+	}
+	return result
+}
+
+func hasTag(tag reflect.StructTag, names []string) bool {
+	if len(names) == 0 {
+		return len(tag) != 0
+	}
+	for _, name := range names {
+		if len(tag.Get(name)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// tagKeys returns keys of given struct tag in order. As in
+// reflect.StructTag.Get, malformed parts and the rest of them are ignored.
+func tagKeys(tag reflect.StructTag) []string {
+	var keys []string
+	for tag != "" {
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		name := string(tag[:i])
+		tag = tag[i+1:]
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			break
+		}
+		tag = tag[i+1:]
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// resolveExtends replaces definitions named name with definitions of
+// referenced fields. Definitions declared in a field itself take precedence
+// over inherited ones.
+func resolveExtends(fields map[string][]Definition, name string, typeName string) (map[string][]Definition, error) {
+	resolved := map[string][]Definition{}
+	visiting := map[string]bool{}
+	var resolve func(field string) ([]Definition, error)
+	resolve = func(field string) ([]Definition, error) {
+		if defs, ok := resolved[field]; ok {
+			return defs, nil
+		}
+		if visiting[field] {
+			return nil, fmt.Errorf("%s.%s: cyclic %s", typeName, field, name)
+		}
+		visiting[field] = true
+		own := fields[field]
+		names := map[string]bool{}
+		for _, def := range own {
+			names[def.Name()] = true
+		}
+		defs := []Definition{}
+		for _, def := range own {
+			if def.Name() != name {
+				defs = append(defs, def)
+				continue
+			}
+			v, _ := def.Attribute(name)
+			refs, ok := v.([]interface{})
+			if !ok {
+				refs = []interface{}{v}
+			}
+			for _, ref := range refs {
+				refName, ok := ref.(string)
+				if _, exists := fields[refName]; !ok || !exists {
+					return nil, fmt.Errorf("%s.%s: %s refers an unknown field: %v", typeName, field, name, ref)
+				}
+				inherited, err := resolve(refName)
+				if err != nil {
+					return nil, err
+				}
+				for _, idef := range inherited {
+					if !names[idef.Name()] {
+						names[idef.Name()] = true
+						defs = append(defs, idef)
+					}
+				}
+			}
+		}
+		resolved[field] = defs
+		return defs, nil
+	}
+
+	keys := make([]string, 0, len(fields))
+	for field := range fields {
+		keys = append(keys, field)
+	}
+	sort.Strings(keys)
+	for _, field := range keys {
+		if _, err := resolve(field); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// ParseStructMerged parses struct tags of given object for each tag name and
+// merges definitions per field. Definitions of later tags override
+// definitions with the same name of earlier tags. map key is a field name.
+func ParseStructMerged(obj interface{}, tags []string) (map[string][]Definition, error) {
+	result := map[string][]Definition{}
+	for _, tag := range tags {
+		fields, err := ParseStruct(obj, tag)
+		if err != nil {
+			return nil, err
+		}
+		for field, defs := range fields {
+			result[field] = mergeDefinitions(result[field], defs)
+		}
+	}
+	return result, nil
+}
+
+// ParseStructAll parses struct tags of given object for each tag name in
+// a single pass over the fields. If tags is empty, all non-empty tags are
+// parsed. The outer map key is a tag name and the inner map key is a field
+// name. Embedded structs that have any of the tags are treated as regular
+// fields.
+func ParseStructAll(obj interface{}, tags ...string) (map[string]map[string][]Definition, error) {
+	result := map[string]map[string][]Definition{}
+	for _, tag := range tags {
+		result[tag] = map[string][]Definition{}
+	}
+	r := reflect.ValueOf(obj)
+	if r.Kind() == reflect.Ptr {
+		obj = r.Elem().Interface()
+	}
+	rv := reflect.TypeOf(obj)
+	for _, f := range structFields(rv, tags) {
+		names := tags
+		if len(names) == 0 {
+			names = tagKeys(f.Tag)
+		}
+		for _, tag := range names {
+			value := f.Tag.Get(tag)
+			if len(value) == 0 {
+				continue
+			}
+			defs, err := ParseTag(value, rv.Name()+"."+f.Name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", tag, err)
+			}
+			if result[tag] == nil {
+				result[tag] = map[string][]Definition{}
+			}
+			result[tag][f.Name] = defs
+		}
+	}
+	return result, nil
+}
+
+// FieldDoc is a parse result of a field with its documentation.
+type FieldDoc struct {
+	// Definitions are definitions parsed from the tag
+	Definitions []Definition
+	// Description is a value of the doc tag
+	Description string
+}
+
+// ParseStructWithDocs parses struct tags of given object and pairs them with
+// values of docTag. Fields that have either of the tags are returned.
+// map key is a field name.
+func ParseStructWithDocs(obj interface{}, tag, docTag string) (map[string]FieldDoc, error) {
+	result := map[string]FieldDoc{}
+	r := reflect.ValueOf(obj)
+	if r.Kind() == reflect.Ptr {
+		obj = r.Elem().Interface()
+	}
+	rv := reflect.TypeOf(obj)
+	for _, f := range structFields(rv, []string{tag, docTag}) {
+		value := f.Tag.Get(tag)
+		doc := FieldDoc{Description: f.Tag.Get(docTag)}
+		if len(value) == 0 && len(doc.Description) == 0 {
+			continue
+		}
+		if len(value) != 0 {
+			defs, err := ParseTag(value, rv.Name()+"."+f.Name)
+			if err != nil {
+				return nil, err
+			}
+			doc.Definitions = defs
+		}
+		result[f.Name] = doc
+	}
+	return result, nil
+}
+
+func mergeDefinitions(base, overrides []Definition) []Definition {
+	overridden := map[string][]Definition{}
+	for _, def := range overrides {
+		overridden[def.Name()] = append(overridden[def.Name()], def)
+	}
+	result := make([]Definition, 0, len(base)+len(overrides))
+	for _, def := range base {
+		defs, ok := overridden[def.Name()]
+		if !ok {
+			result = append(result, def)
+			continue
+		}
+		// replace the first definition and drop others
+		result = append(result, defs...)
+		overridden[def.Name()] = nil
+	}
+	placed := map[string]bool{}
+	for _, def := range result {
+		placed[def.Name()] = true
+	}
+	for _, def := range overrides {
+		if !placed[def.Name()] {
+			result = append(result, def)
+		}
+	}
+	return result
+}
+
+// DefinitionNames parses struct tags of given object and returns names of
+// definitions in source order. map key is a field name.
+func DefinitionNames(obj interface{}, tag string) (map[string][]string, error) {
+	fields, err := ParseStruct(obj, tag)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]string, len(fields))
+	for field, defs := range fields {
+		names := make([]string, 0, len(defs))
+		for _, def := range defs {
+			names = append(names, def.Name())
+		}
+		result[field] = names
+	}
 	return result, nil
 }
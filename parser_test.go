@@ -1,15 +1,25 @@
 package stagparser_test
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
+	"unicode"
+	// embeds the time zone database for timezone tests
+	_ "time/tzdata"
 
 	. "github.com/yuin/stagparser"
 )
 
 type StructA struct {
-	f1 string `t1:"abc=1,def=ghi,jkl='mno',pkr=[1, -100.009, aaa, bbb, -56],stu(vwx=ccc, zzz=ddd), a1"` // nolint
-	f2 string `t1:"abd='\\r\\n\\''"`                                                                    // nolint
-	f3 string `t1:"aaa,bbb"`                                                                            // nolint
+	f1 string `t1:"abc=1,def=ghi,jkl='mno',pkr=[1, -100.009, aaa, bbb, -56],stu(vwx=ccc, zzz=ddd), a1" t2:"abc=("` // nolint
+	f2 string `t1:"abd='\\r\\n\\''"`                                                                               // nolint
+	f3 string `t1:"aaa,bbb"`                                                                                       // nolint
 }
 
 func TestExampleSuccess(t *testing.T) {
@@ -149,3 +159,1938 @@ func TestExampleSuccess(t *testing.T) {
 		t.Fatalf("2nd f3 definition should be 'bbb'")
 	}
 }
+
+func TestHexEscape(t *testing.T) {
+	defs, err := ParseTag(`a='\x41\xe9'`, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, ok := defs[0].Attribute("a"); !ok || v.(string) != "Aé" {
+		t.Fatalf("a attribute should be \"Aé\" but got %v(%T)", v, v)
+	}
+
+	_, err = ParseTag(`a='\xZZ'`, "t")
+	if err == nil {
+		t.Fatalf("invalid hex escape should be an error")
+	}
+	if _, ok := err.(ParseError); !ok {
+		t.Fatalf("error should be a ParseError but got %T", err)
+	}
+}
+
+func TestUnicodeEscape(t *testing.T) {
+	defs, err := ParseTag(`a='\u00e9\u00a0',b="\U0001F600"`, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("a"); v != "\u00e9\u00a0" {
+		t.Fatalf("a attribute should be \"é\\u00a0\" but got %q", v)
+	}
+	if v, _ := defs[1].Attribute("b"); v != "\U0001F600" {
+		t.Fatalf("b attribute should be \"\\U0001F600\" but got %q", v)
+	}
+
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{`a='\xZZ'`, "invalid escape sequence: xZ (1:6 [t])"},
+		{`a='\u00g9'`, "invalid escape sequence: ug (1:8 [t])"},
+		{`a='\u00e'`, "invalid escape sequence: u' (1:9 [t])"},
+		{`a='\U0011FFFF'`, "invalid escape sequence: U11ffff"},
+	} {
+		_, err := ParseTag(c.tag, "t")
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Fatalf("%s should be %q error but got %v", c.tag, c.expected, err)
+		}
+	}
+}
+
+func TestParseSingle(t *testing.T) {
+	def, err := ParseSingle("length(min=1, max=10)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if def.Name() != "length" {
+		t.Fatalf("definition should be 'length' but got %s", def.Name())
+	}
+
+	if _, err := ParseSingle("", "t"); err == nil {
+		t.Fatalf("empty tag should be an error")
+	}
+	if _, err := ParseSingle("required,max=10", "t"); err == nil {
+		t.Fatalf("multiple definitions should be an error")
+	}
+}
+
+func TestIndexedKeys(t *testing.T) {
+	defs, err := ParseTagWithOptions("point(x0=1, x1=2, x2=3, y=4)", "t", WithIndexedKeys())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	point := defs[0]
+	if Len(point) != 2 {
+		t.Fatalf("'point' should have two attributes but got %v", point.Attributes())
+	}
+	v, ok := point.Attribute("x")
+	if !ok {
+		t.Fatalf("x attribute should be exists")
+	}
+	x := v.([]interface{})
+	if len(x) != 3 || x[0].(int64) != 1 || x[1].(int64) != 2 || x[2].(int64) != 3 {
+		t.Fatalf("x attribute should be [1, 2, 3] but got %v", x)
+	}
+
+	_, err = ParseTagWithOptions("point(x0=1, x2=3)", "t", WithIndexedKeys())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "missing index: x1") || perr.Line() != 1 || perr.Column() != 6 {
+		t.Fatalf("non-contiguous indices should be an error at 1:6 but got %v", err)
+	}
+
+	defs, err = ParseTagWithOptions("point(x0=1, x2=3)", "t", WithIndexedKeyGaps())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	v, _ = defs[0].Attribute("x")
+	x = v.([]interface{})
+	if len(x) != 3 || x[0].(int64) != 1 || x[1] != nil || x[2].(int64) != 3 {
+		t.Fatalf("x attribute should be [1, nil, 3] but got %v", x)
+	}
+
+	defs, err = ParseTag("point(x0=1, x1=2)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if Len(defs[0]) != 2 {
+		t.Fatalf("indexed keys should not be collapsed by default")
+	}
+
+	defs, err = ParseTagWithOptions("p(utf8=true)", "t", WithIndexedKeys())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, ok := defs[0].Attribute("utf8"); !ok || v != true {
+		t.Fatalf("a lone numbered key should stay a plain attribute but got %v", defs[0].Attributes())
+	}
+
+	_, err = ParseTagWithOptions("p(x0=1, x99999999999=1)", "t", WithIndexedKeyGaps())
+	perr, ok = err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "index too large: x99999999999") || perr.Column() != 2 {
+		t.Fatalf("a huge index should be an error at 1:2 but got %v", err)
+	}
+}
+
+func TestDescriptionComments(t *testing.T) {
+	defs, err := ParseTagWithOptions("/* must be set */ required, max=10, // at most 5\nmin=5", "t",
+		WithDescriptionComments())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("tag should be parsed into 3 definitions but %d", len(defs))
+	}
+	if defs[0].Name() != "required" || defs[0].Description() != "must be set" {
+		t.Fatalf("'required' should have a description \"must be set\" but got %q", defs[0].Description())
+	}
+	if defs[1].Description() != "" {
+		t.Fatalf("'max' should not have a description but got %q", defs[1].Description())
+	}
+	if defs[2].Description() != "at most 5" {
+		t.Fatalf("'min' should have a description \"at most 5\" but got %q", defs[2].Description())
+	}
+
+	defs, err = ParseTag("/* must be set */ required", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if defs[0].Description() != "" {
+		t.Fatalf("comments should be ignored by default")
+	}
+}
+
+func TestFlagArgs(t *testing.T) {
+	defs, err := ParseTagWithOptions("field(readonly, !cached, max=10)", "t", WithFlagArgs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	field := defs[0]
+	if v, ok := field.Attribute("readonly"); !ok || v.(bool) != true {
+		t.Fatalf("readonly attribute should be true but got %v(%T)", v, v)
+	}
+	if v, ok := field.Attribute("cached"); !ok || v.(bool) != false {
+		t.Fatalf("cached attribute should be false but got %v(%T)", v, v)
+	}
+	if v, ok := field.Attribute("max"); !ok || v.(int64) != 10 {
+		t.Fatalf("max attribute should be 10(int64) but got %v(%T)", v, v)
+	}
+
+	if _, err := ParseTag("field(readonly, !cached)", "t"); err == nil {
+		t.Fatalf("flag attributes should be an error by default")
+	}
+}
+
+func TestDefinitionNames(t *testing.T) {
+	result, err := DefinitionNames(&StructA{}, "t1")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	expected := map[string][]string{
+		"f1": {"abc", "def", "jkl", "pkr", "stu", "a1"},
+		"f2": {"abd"},
+		"f3": {"aaa", "bbb"},
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("%d fields should be parsed but got %d", len(expected), len(result))
+	}
+	for field, names := range expected {
+		if strings.Join(result[field], ",") != strings.Join(names, ",") {
+			t.Fatalf("field %s should have %v but got %v", field, names, result[field])
+		}
+	}
+}
+
+func TestFieldRefs(t *testing.T) {
+	defs, err := ParseTagWithOptions("eqfield=$Password,ltfield(field=$User.Address.Zip)", "t", WithFieldRefs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	v, _ := defs[0].Attribute("eqfield")
+	if ref, ok := v.(FieldRef); !ok || len(ref.Path) != 1 || ref.Path[0] != "Password" {
+		t.Fatalf("eqfield attribute should be $Password but got %v(%T)", v, v)
+	}
+	v, _ = defs[1].Attribute("field")
+	ref, ok := v.(FieldRef)
+	if !ok || len(ref.Path) != 3 {
+		t.Fatalf("field attribute should be a FieldRef with 3 segments but got %v(%T)", v, v)
+	}
+	if ref.String() != "$User.Address.Zip" {
+		t.Fatalf("field attribute should be $User.Address.Zip but got %s", ref.String())
+	}
+
+	if _, err := ParseTagWithOptions("eqfield=$User.", "t", WithFieldRefs()); err == nil {
+		t.Fatalf("a trailing dot should be an error")
+	}
+	if _, err := ParseTag("eqfield=$Password", "t"); err == nil {
+		t.Fatalf("field references should be an error by default")
+	}
+}
+
+func TestSeparator(t *testing.T) {
+	defs, err := ParseTagWithOptions("required;length(min=1, max=10);max=10", "t", WithSeparator(';'))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("tag should be parsed into 3 definitions but %d", len(defs))
+	}
+	if defs[1].Name() != "length" || Len(defs[1]) != 2 {
+		t.Fatalf("2nd definition should be 'length' with two attributes")
+	}
+
+	for _, c := range []struct {
+		tag  string
+		opts []ParserOption
+	}{
+		{"required,", nil},
+		{"required;", []ParserOption{WithSeparator(';')}},
+	} {
+		defs, err := ParseTagWithOptions(c.tag, "t", c.opts...)
+		if err != nil {
+			t.Fatalf("parse failed: %s", err.Error())
+		}
+		if len(defs) != 1 || defs[0].Name() != "required" {
+			t.Fatalf("%s should be parsed into exactly one definition but got %d", c.tag, len(defs))
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	defs, err := ParseTagWithOptions("size(max=1024*1024, min=(1+2)*3, ratio=1/2.0, neg=-2*-3)", "t", WithArithmetic())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	size := defs[0]
+	if v, _ := size.Attribute("max"); v.(int64) != 1048576 {
+		t.Fatalf("max attribute should be 1048576(int64) but got %v(%T)", v, v)
+	}
+	if v, _ := size.Attribute("min"); v.(int64) != 9 {
+		t.Fatalf("min attribute should be 9(int64) but got %v(%T)", v, v)
+	}
+	if v, _ := size.Attribute("ratio"); v.(float64) != 0.5 {
+		t.Fatalf("ratio attribute should be 0.5(float64) but got %v(%T)", v, v)
+	}
+	if v, _ := size.Attribute("neg"); v.(int64) != 6 {
+		t.Fatalf("neg attribute should be 6(int64) but got %v(%T)", v, v)
+	}
+
+	if _, err := ParseTagWithOptions("max=1/0", "t", WithArithmetic()); err == nil {
+		t.Fatalf("division by zero should be an error")
+	}
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{"max=9223372036854775807*2", "integer overflow: 9223372036854775807 * 2 (1:24 [t])"},
+		{"max=9223372036854775807+1", "integer overflow: 9223372036854775807 + 1 (1:24 [t])"},
+		{"max=-9223372036854775808-1", "integer overflow: -9223372036854775808 - 1 (1:25 [t])"},
+		{"max=-9223372036854775808/-1", "integer overflow: -9223372036854775808 / -1 (1:25 [t])"},
+		{"max=-(-9223372036854775808)", "integer overflow: 0 - -9223372036854775808 (1:5 [t])"},
+		{"max=9223372036854775808", "invalid integer: 9223372036854775808 (1:5 [t])"},
+	} {
+		_, err := ParseTagWithOptions(c.tag, "t", WithArithmetic())
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("%s should be %q error but got %v", c.tag, c.expected, err)
+		}
+	}
+	defs, err = ParseTagWithOptions("max=(1+2 ), min=-9223372036854775808", "t", WithArithmetic())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("max"); v.(int64) != 3 {
+		t.Fatalf("max attribute should be 3(int64) but got %v(%T)", v, v)
+	}
+	if v, _ := defs[1].Attribute("min"); v.(int64) != math.MinInt64 {
+		t.Fatalf("min attribute should be math.MinInt64 but got %v(%T)", v, v)
+	}
+	if _, err := ParseTag("max=1024*1024", "t"); err == nil {
+		t.Fatalf("arithmetic expressions should be an error by default")
+	}
+}
+
+type StructExtends struct {
+	A string `t1:"required,length(min=1, max=10)"` // nolint
+	B string `t1:"extends(A),max=5"`               // nolint
+	C string `t1:"length(min=2),extends(B)"`       // nolint
+	D string `t1:"extends=C"`                      // nolint
+}
+
+type StructExtendsCycle struct {
+	A string `t1:"extends(B)"` // nolint
+	B string `t1:"extends(A)"` // nolint
+}
+
+type StructExtendsUnknown struct {
+	A string `t1:"extends(Unknown)"` // nolint
+}
+
+func TestExtends(t *testing.T) {
+	result, err := ParseStructWithOptions(&StructExtends{}, "t1", WithExtends("extends"))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	names := func(defs []Definition) string {
+		s := []string{}
+		for _, def := range defs {
+			s = append(s, def.Name())
+		}
+		return strings.Join(s, ",")
+	}
+	if n := names(result["B"]); n != "required,length,max" {
+		t.Fatalf("B should have required,length,max but got %s", n)
+	}
+	if n := names(result["C"]); n != "length,required,max" {
+		t.Fatalf("C should have length,required,max but got %s", n)
+	}
+	if v, _ := result["C"][0].Attribute("min"); v.(int64) != 2 {
+		t.Fatalf("C should keep its own length definition")
+	}
+	if n := names(result["D"]); n != "length,required,max" {
+		t.Fatalf("D should have length,required,max but got %s", n)
+	}
+
+	if _, err := ParseStructWithOptions(&StructExtendsCycle{}, "t1", WithExtends("extends")); err == nil {
+		t.Fatalf("cyclic extends should be an error")
+	}
+	if _, err := ParseStructWithOptions(&StructExtendsUnknown{}, "t1", WithExtends("extends")); err == nil {
+		t.Fatalf("extending an unknown field should be an error")
+	}
+}
+
+func TestColorLiterals(t *testing.T) {
+	defs, err := ParseTagWithOptions("style(short=#f00, long=#00ff7f, alpha=#0000FF80)", "t", WithColorLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for name, expected := range map[string]Color{
+		"short": {R: 255, G: 0, B: 0, A: 255},
+		"long":  {R: 0, G: 255, B: 127, A: 255},
+		"alpha": {R: 0, G: 0, B: 255, A: 128},
+	} {
+		v, _ := defs[0].Attribute(name)
+		if c, ok := v.(Color); !ok || c != expected {
+			t.Fatalf("%s attribute should be %v but got %v(%T)", name, expected, v, v)
+		}
+	}
+
+	for _, tag := range []string{"color=#ff00zz", "color=#ff00", "color=#"} {
+		_, err := ParseTagWithOptions(tag, "t", WithColorLiterals())
+		perr, ok := err.(ParseError)
+		if !ok || !strings.HasPrefix(perr.Error(), "invalid color") || perr.Line() != 1 || perr.Column() != 7 {
+			t.Fatalf("%s should be an error at 1:7 but got %v", tag, err)
+		}
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	result, err := ParseLines(strings.NewReader("\n# comment\nrequired,length(min=1, max=10)\n"), "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(result) != 1 {
+		t.Fatalf("input should be parsed into 1 result but got %d", len(result))
+	}
+	if len(result[0]) != 2 || result[0][1].Name() != "length" {
+		t.Fatalf("3rd line should be parsed into required and length")
+	}
+
+	_, err = ParseLines(strings.NewReader("required\n\nlength(min=1, max=?)\n"), "t")
+	if err == nil {
+		t.Fatalf("a malformed line should be an error")
+	}
+	if perr, ok := err.(ParseError); !ok || perr.Line() != 3 {
+		t.Fatalf("error should be reported at line 3 but got %v", err)
+	}
+}
+
+func TestDefaultAttributes(t *testing.T) {
+	opt := WithDefaultAttributes(map[string]map[string]interface{}{
+		"length": {"min": int64(0)},
+	})
+	defs, err := ParseTagWithOptions("length(max=10),required", "t", opt)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, ok := defs[0].Attribute("min"); !ok || v.(int64) != 0 {
+		t.Fatalf("min attribute should be 0(int64) but got %v(%T)", v, v)
+	}
+	if v, ok := defs[0].Attribute("max"); !ok || v.(int64) != 10 {
+		t.Fatalf("max attribute should be 10(int64) but got %v(%T)", v, v)
+	}
+	if Len(defs[1]) != 0 {
+		t.Fatalf("'required' should not have attributes")
+	}
+
+	defs, err = ParseTagWithOptions("length(min=2,max=10)", "t", opt)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, ok := defs[0].Attribute("min"); !ok || v.(int64) != 2 {
+		t.Fatalf("min attribute should be 2(int64) but got %v(%T)", v, v)
+	}
+
+	defaults := map[string]map[string]interface{}{
+		"in": {"values": []interface{}{"a", map[string]interface{}{"k": int64(1)}}},
+	}
+	opt = WithDefaultAttributes(defaults)
+	defs, err = ParseTagWithOptions("in", "t", opt)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	values, _ := defs[0].Attribute("values")
+	values.([]interface{})[0] = "b"
+	values.([]interface{})[1].(map[string]interface{})["k"] = int64(2)
+	if v := defaults["in"]["values"].([]interface{}); v[0] != "a" || v[1].(map[string]interface{})["k"] != int64(1) {
+		t.Fatalf("default values should not be shared with definitions but got %v", v)
+	}
+	defs, _ = ParseTagWithOptions("in", "t", opt)
+	if v, _ := defs[0].Attribute("values"); v.([]interface{})[0] != "a" {
+		t.Fatalf("default values should not be shared between parses but got %v", v)
+	}
+}
+
+func TestTrailingFlags(t *testing.T) {
+	defs, err := ParseTagWithOptions("type(email) required,email required trimmed,max=10", "t",
+		WithTrailingFlags(), WithFlagArgs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("tag should be parsed into 3 definitions but %d", len(defs))
+	}
+	typ := defs[0]
+	if typ.Name() != "type" || Len(typ) != 2 {
+		t.Fatalf("'type' should have two attributes but got %v", typ.Attributes())
+	}
+	if v, _ := typ.Attribute("email"); v != true {
+		t.Fatalf("email attribute should be true but got %v", v)
+	}
+	if v, _ := typ.Attribute("required"); v != true {
+		t.Fatalf("required attribute should be true but got %v", v)
+	}
+	email := defs[1]
+	if email.Name() != "email" || Len(email) != 2 {
+		t.Fatalf("'email' should have two attributes but got %v", email.Attributes())
+	}
+
+	if _, err := ParseTagWithOptions("type(email) max=10", "t", WithTrailingFlags(), WithFlagArgs()); err == nil {
+		t.Fatalf("a trailing definition with attributes should be an error")
+	}
+}
+
+func TestSpaceArgs(t *testing.T) {
+	defs, err := ParseTagWithOptions("meta(author=bob role=admin),mixed(a=1 b=2, c=3 , d=4 )", "t", WithSpaceArgs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	meta := defs[0]
+	if Len(meta) != 2 {
+		t.Fatalf("'meta' should have two attributes but got %v", meta.Attributes())
+	}
+	if v, _ := meta.Attribute("role"); v != "admin" {
+		t.Fatalf("role attribute should be \"admin\" but got %v", v)
+	}
+	mixed := defs[1]
+	if Len(mixed) != 4 {
+		t.Fatalf("'mixed' should have four attributes but got %v", mixed.Attributes())
+	}
+
+	if _, err := ParseTag("meta(author=bob role=admin)", "t"); err == nil {
+		t.Fatalf("space separated attributes should be an error by default")
+	}
+}
+
+func TestMustParseStruct(t *testing.T) {
+	result := MustParseStruct(&StructA{}, "t1")
+	if len(result) != 3 {
+		t.Fatalf("3 fields should be parsed but got %d", len(result))
+	}
+
+	type invalid struct {
+		f1 string `t1:"length(min=?)"` // nolint
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("invalid tags should cause a panic")
+		}
+	}()
+	MustParseStruct(&invalid{}, "t1")
+}
+
+func TestPercentDecoding(t *testing.T) {
+	defs, err := ParseTagWithOptions("file(path='%2Ftmp%2Ffile', list=['a%20b','c+d'])", "t", WithPercentDecoding())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("path"); v != "/tmp/file" {
+		t.Fatalf("path attribute should be \"/tmp/file\" but got %v", v)
+	}
+	v, _ := defs[0].Attribute("list")
+	if list := v.([]interface{}); list[0] != "a b" || list[1] != "c+d" {
+		t.Fatalf("list attribute should be [\"a b\" \"c+d\"] but got %v", list)
+	}
+
+	_, err = ParseTagWithOptions("path='%2'", "t", WithPercentDecoding())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "invalid percent encoding") || perr.Line() != 1 || perr.Column() != 6 {
+		t.Fatalf("a malformed percent encoding should be an error at 1:6 but got %v", err)
+	}
+	defs, _ = ParseTag("path='%2Ftmp'", "t")
+	if v, _ := defs[0].Attribute("path"); v != "%2Ftmp" {
+		t.Fatalf("path attribute should not be decoded by default but got %v", v)
+	}
+}
+
+func TestParseTagMapped(t *testing.T) {
+	tag := "required, max=10,length(min=1, max=10)"
+	defs, m, err := ParseTagMapped(tag, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("tag should be parsed into 3 definitions but %d", len(defs))
+	}
+	for _, c := range []struct {
+		offset     int
+		definition string
+		attribute  string
+	}{
+		{0, "required", ""},
+		{7, "required", ""},
+		{strings.Index(tag, "max=10"), "max", "max"},
+		{strings.Index(tag, "length"), "length", ""},
+		{strings.Index(tag, "min"), "length", "min"},
+		{strings.Index(tag, "1,"), "length", "min"},
+		{strings.LastIndex(tag, "max"), "length", "max"},
+		{strings.LastIndex(tag, "10"), "length", "max"},
+		{len(tag) - 1, "length", ""},
+	} {
+		e, ok := m.Lookup(c.offset)
+		if !ok {
+			t.Fatalf("offset %d should be mapped", c.offset)
+		}
+		if e.Definition.Name() != c.definition || e.Attribute != c.attribute {
+			t.Fatalf("offset %d should be mapped to %s.%s but got %s.%s",
+				c.offset, c.definition, c.attribute, e.Definition.Name(), e.Attribute)
+		}
+	}
+	if _, ok := m.Lookup(8); ok {
+		t.Fatalf("a separator should not be mapped")
+	}
+}
+
+type StructMerged struct {
+	F1 string `validate:"required,length(min=1, max=10),max=5" validate2:"length(min=2),trim"` // nolint
+	F2 string `validate:"required"`                                                            // nolint
+	F3 string `validate2:"email"`                                                              // nolint
+}
+
+func TestParseStructMerged(t *testing.T) {
+	result, err := ParseStructMerged(&StructMerged{}, []string{"validate", "validate2"})
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	names := func(defs []Definition) string {
+		s := []string{}
+		for _, def := range defs {
+			s = append(s, def.Name())
+		}
+		return strings.Join(s, ",")
+	}
+	if n := names(result["F1"]); n != "required,length,max,trim" {
+		t.Fatalf("F1 should have required,length,max,trim but got %s", n)
+	}
+	length := result["F1"][1]
+	if _, ok := length.Attribute("max"); ok || Len(length) != 1 {
+		t.Fatalf("length of F1 should be overridden but got %v", length.Attributes())
+	}
+	if n := names(result["F2"]); n != "required" {
+		t.Fatalf("F2 should have required but got %s", n)
+	}
+	if n := names(result["F3"]); n != "email" {
+		t.Fatalf("F3 should have email but got %s", n)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	errs := []ParseError{}
+	defs, err := ParseTagWithOptions("required,length(min=?, max='a,b'),?,max=10", "t", WithRecover(func(err ParseError) bool {
+		errs = append(errs, err)
+		return true
+	}))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(errs) != 2 {
+		t.Fatalf("callback should be called 2 times but got %d", len(errs))
+	}
+	if len(defs) != 2 || defs[0].Name() != "required" || defs[1].Name() != "max" {
+		t.Fatalf("required and max should be parsed but got %d definitions", len(defs))
+	}
+
+	calls := 0
+	_, err = ParseTagWithOptions("required,length(min=?),?,max=10", "t", WithRecover(func(err ParseError) bool {
+		calls++
+		return false
+	}))
+	if err == nil {
+		t.Fatalf("parse should be aborted")
+	}
+	if calls != 1 {
+		t.Fatalf("callback should be called once but got %d", calls)
+	}
+}
+
+func TestRawDefinitions(t *testing.T) {
+	defs, err := ParseTagWithOptions("required,expr(a + (b*c) > ')'),length(min=1)", "t", WithRawDefinitions("expr"))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("tag should be parsed into 3 definitions but %d", len(defs))
+	}
+	if v, ok := defs[1].Attribute("expr"); !ok || v != "a + (b*c) > ')'" {
+		t.Fatalf("expr attribute should be \"a + (b*c) > ')'\" but got %v", v)
+	}
+
+	if _, err := ParseTagWithOptions("expr(a + (b*c)", "t", WithRawDefinitions("expr")); err == nil {
+		t.Fatalf("unbalanced parentheses should be an error")
+	}
+}
+
+func TestPathValues(t *testing.T) {
+	defs, err := ParseTagWithOptions("path=/etc/hosts,file(rel=./rel/file.txt, up=../a, quoted='/my dir/a b'),list=[/a,/b]", "t",
+		WithPathValues())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("path"); v != "/etc/hosts" {
+		t.Fatalf("path attribute should be \"/etc/hosts\" but got %v", v)
+	}
+	for name, expected := range map[string]string{"rel": "./rel/file.txt", "up": "../a", "quoted": "/my dir/a b"} {
+		if v, _ := defs[1].Attribute(name); v != expected {
+			t.Fatalf("%s attribute should be %q but got %v", name, expected, v)
+		}
+	}
+	v, _ := defs[2].Attribute("list")
+	if list := v.([]interface{}); len(list) != 2 || list[0] != "/a" || list[1] != "/b" {
+		t.Fatalf("list attribute should be [/a /b] but got %v", list)
+	}
+
+	if _, err := ParseTag("path=/etc/hosts", "t"); err == nil {
+		t.Fatalf("unquoted paths should be an error by default")
+	}
+}
+
+func TestLiteralsInArrays(t *testing.T) {
+	for _, c := range []struct {
+		tag      string
+		opt      ParserOption
+		expected string
+	}{
+		{"list=[{X:1}, {Y:2}]", WithGoComposites(), "[{map[X:1]} {map[Y:2]}]"},
+		{"list=[1, #fff]", WithColorLiterals(), "[1 #ffffffff]"},
+		{"list=[a, /etc/hosts]", WithPathValues(), "[a /etc/hosts]"},
+		{"list=[$A.B, $C]", WithFieldRefs(), "[$A.B $C]"},
+		{"list=[ ${A}]", WithPlaceholders(), "[${A}]"},
+		{"list=[a, 00:1A:2B:3C:4D:5E]", WithMACLiterals(), "[a 00:1a:2b:3c:4d:5e]"},
+		{"list=[a, b64:AQI=]", WithBase64Literals(), "[a [1 2]]"},
+	} {
+		defs, err := ParseTagWithOptions(c.tag, "t", c.opt)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %s", c.tag, err.Error())
+		}
+		v, _ := defs[0].ArrayAttribute("list")
+		if s := fmt.Sprint(v); s != c.expected {
+			t.Fatalf("%s: list should be %s but got %s", c.tag, c.expected, s)
+		}
+	}
+}
+
+func TestTimezoneLiterals(t *testing.T) {
+	defs, err := ParseTagWithOptions("tz(zone=America/New_York, utc=UTC, name=Tokyo, ext=America/Argentina/Buenos_Aires)", "t",
+		WithTimezoneLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	tz := defs[0]
+	for name, expected := range map[string]string{
+		"zone": "America/New_York",
+		"utc":  "UTC",
+		"ext":  "America/Argentina/Buenos_Aires",
+	} {
+		v, _ := tz.Attribute(name)
+		if loc, ok := v.(*time.Location); !ok || loc.String() != expected {
+			t.Fatalf("%s attribute should be %s(*time.Location) but got %v(%T)", name, expected, v, v)
+		}
+	}
+	if v, _ := tz.Attribute("name"); v != "Tokyo" {
+		t.Fatalf("name attribute should be \"Tokyo\" but got %v(%T)", v, v)
+	}
+
+	_, err = ParseTagWithOptions("tz(zone=Mars/Olympus)", "t", WithTimezoneLiterals())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "invalid time zone") || perr.Line() != 1 || perr.Column() != 9 {
+		t.Fatalf("an invalid time zone should be an error at 1:9 but got %v", err)
+	}
+}
+
+func TestGoComposites(t *testing.T) {
+	defs, err := ParseTagWithOptions(`default={Name: "x", Age:30, Tags: [a, b]},list=[{X:1}, {}]`, "t", WithGoComposites())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	v, _ := defs[0].Attribute("default")
+	lit, ok := v.(CompositeLit)
+	if !ok {
+		t.Fatalf("default attribute should be a CompositeLit but got %T", v)
+	}
+	if len(lit.Fields) != 3 || lit.Fields["Name"] != "x" || lit.Fields["Age"].(int64) != 30 {
+		t.Fatalf("default attribute should be {Name: \"x\", Age: 30, Tags: [a, b]} but got %v", lit.Fields)
+	}
+	v, _ = defs[1].Attribute("list")
+	list := v.([]interface{})
+	if len(list) != 2 {
+		t.Fatalf("list attribute should have two elements but got %v", list)
+	}
+	if lit, ok := list[0].(CompositeLit); !ok || lit.Fields["X"].(int64) != 1 {
+		t.Fatalf("list[0] should be {X: 1} but got %v(%T)", list[0], list[0])
+	}
+	if lit, ok := list[1].(CompositeLit); !ok || len(lit.Fields) != 0 {
+		t.Fatalf("list[1] should be {} but got %v(%T)", list[1], list[1])
+	}
+
+	if _, err := ParseTagWithOptions(`default={Name="x"}`, "t", WithGoComposites()); err == nil {
+		t.Fatalf("a missing colon should be an error")
+	}
+}
+
+func TestSliceRefs(t *testing.T) {
+	defs, err := ParseTagWithOptions("s(tail=all[-2:], init=all[:-1], mid=all[1:3], whole=all[:], name=all)", "t",
+		WithSliceRefs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for name, expected := range map[string]string{
+		"tail":  "all[-2:]",
+		"init":  "all[:-1]",
+		"mid":   "all[1:3]",
+		"whole": "all[:]",
+	} {
+		v, _ := defs[0].Attribute(name)
+		ref, ok := v.(SliceRef)
+		if !ok || ref.Name != "all" || ref.String() != expected {
+			t.Fatalf("%s attribute should be %s but got %v(%T)", name, expected, v, v)
+		}
+	}
+	v, _ := defs[0].Attribute("tail")
+	if ref := v.(SliceRef); *ref.Low != -2 || ref.High != nil {
+		t.Fatalf("tail attribute should have low=-2 and no high")
+	}
+	if v, _ := defs[0].Attribute("name"); v != "all" {
+		t.Fatalf("name attribute should be \"all\" but got %v(%T)", v, v)
+	}
+
+	for _, tag := range []string{"s=all[1]", "s=all[a:]", "s=all[1:2"} {
+		if _, err := ParseTagWithOptions(tag, "t", WithSliceRefs()); err == nil {
+			t.Fatalf("%s should be an error", tag)
+		}
+	}
+}
+
+func TestPositionalArgs(t *testing.T) {
+	defs, err := ParseTagWithOptions("in(a, 1, 'c d'),range(min=1, max=2)", "t", WithPositionalArgs())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	v, ok := defs[0].Attribute(PositionalArgs)
+	if !ok || Len(defs[0]) != 1 {
+		t.Fatalf("'in' should have only _args attribute but got %v", defs[0].Attributes())
+	}
+	args := v.([]interface{})
+	if len(args) != 3 || args[0] != "a" || args[1].(int64) != 1 || args[2] != "c d" {
+		t.Fatalf("_args attribute should be [a 1 c d] but got %v", args)
+	}
+	if Len(defs[1]) != 2 {
+		t.Fatalf("'range' should have two attributes but got %v", defs[1].Attributes())
+	}
+
+	for _, tag := range []string{"f(a, x=1)", "f(x=1, a)"} {
+		if _, err := ParseTagWithOptions(tag, "t", WithPositionalArgs()); err == nil {
+			t.Fatalf("%s should be an error", tag)
+		}
+	}
+	if _, err := ParseTag("in(a, b)", "t"); err == nil {
+		t.Fatalf("positional attributes should be an error by default")
+	}
+}
+
+func TestBoolAndNullLiterals(t *testing.T) {
+	defs, err := ParseTag("enabled=true,opt(cache=false, def=ghi, nullable=null),flags=[true, false, null],true(x=1)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("enabled"); v != true {
+		t.Fatalf("enabled attribute should be true(bool) but got %v(%T)", v, v)
+	}
+	opt := defs[1]
+	if v, _ := opt.Attribute("cache"); v != false {
+		t.Fatalf("cache attribute should be false(bool) but got %v(%T)", v, v)
+	}
+	if v, _ := opt.Attribute("def"); v != "ghi" {
+		t.Fatalf("def attribute should be \"ghi\" but got %v(%T)", v, v)
+	}
+	if v, ok := opt.Attribute("nullable"); !ok || v != nil {
+		t.Fatalf("nullable attribute should exist and be nil but got %v(%T)", v, v)
+	}
+	v, _ := defs[2].Attribute("flags")
+	if flags := v.([]interface{}); len(flags) != 3 || flags[0] != true || flags[1] != false || flags[2] != nil {
+		t.Fatalf("flags attribute should be [true false nil] but got %v", flags)
+	}
+	if defs[3].Name() != "true" {
+		t.Fatalf("4th definition should be 'true' but got %s", defs[3].Name())
+	}
+
+	s, err := Marshal(defs)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err.Error())
+	}
+	if s != "enabled=true,opt(cache=false,def='ghi',nullable=null),flags=[true,false,null],true(x=1)" {
+		t.Fatalf("unexpected marshal result: %s", s)
+	}
+}
+
+type BaseModel struct {
+	ID      int    `t1:"required"` // nolint
+	Name    string `t1:"max=10"`   // nolint
+	Deleted bool   `t1:"flag"`     // nolint
+}
+
+type Timestamps struct {
+	BaseModel
+	Created string `t1:"datetime"` // nolint
+}
+
+type Audit struct {
+	By string `t1:"required"` // nolint
+}
+
+type Nested struct {
+	Inner Audit `t1:"dive"` // nolint
+}
+
+type StructEmbedded struct {
+	Timestamps
+	*Audit
+	Tagged  BaseModel `t1:"dive"`  // nolint
+	Name    string    `t1:"min=1"` // nolint
+	Deleted bool      // nolint
+	Nested
+}
+
+func TestParseStructEmbedded(t *testing.T) {
+	result, err := ParseStruct(&StructEmbedded{}, "t1")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	expected := map[string]string{
+		"ID":      "required",
+		"Created": "datetime",
+		"By":      "required",
+		"Tagged":  "dive",
+		"Name":    "min",
+		"Inner":   "dive",
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("%d fields should be parsed but got %d: %v", len(expected), len(result), result)
+	}
+	for field, name := range expected {
+		defs, ok := result[field]
+		if !ok || len(defs) != 1 || defs[0].Name() != name {
+			t.Fatalf("field %s should have '%s' but got %v", field, name, defs)
+		}
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	defs, err := ParseTagWithOptions("port(value=${PORT:-8080}),host=${HOST},empty=${EMPTY:-}", "t", WithPlaceholders())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for _, c := range []struct {
+		def      int
+		attr     string
+		expected Placeholder
+	}{
+		{0, "value", Placeholder{Name: "PORT", Default: "8080", HasDefault: true}},
+		{1, "host", Placeholder{Name: "HOST"}},
+		{2, "empty", Placeholder{Name: "EMPTY", HasDefault: true}},
+	} {
+		v, _ := defs[c.def].Attribute(c.attr)
+		if ph, ok := v.(Placeholder); !ok || ph != c.expected {
+			t.Fatalf("%s should be %#v but got %#v", c.attr, c.expected, v)
+		}
+	}
+	s, err := Marshal(defs)
+	if err != nil || s != "port(value=${PORT:-8080}),host=${HOST},empty=${EMPTY:-}" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	for _, tag := range []string{"port=${}", "port=${PORT:-8080", "port=${PORT"} {
+		_, err := ParseTagWithOptions(tag, "t", WithPlaceholders())
+		perr, ok := err.(ParseError)
+		if !ok || perr.Line() != 1 || perr.Column() != 6 {
+			t.Fatalf("%s should be an error at 1:6 but got %v", tag, err)
+		}
+	}
+	if _, err := ParseTag("port=${PORT}", "t"); err == nil {
+		t.Fatalf("placeholders should be disabled by default")
+	}
+}
+
+func TestParseErrorSource(t *testing.T) {
+	_, err := ParseTag("abc=(", "User.Name")
+	perr, ok := err.(ParseError)
+	if !ok || perr.Source() != "User.Name" || !strings.Contains(perr.Error(), "[User.Name]") {
+		t.Fatalf("error source should be User.Name but got %v", err)
+	}
+
+	_, err = ParseStruct(&StructA{}, "t2")
+	perr, ok = err.(ParseError)
+	if !ok || perr.Source() != "StructA.f1" {
+		t.Fatalf("error source should be StructA.f1 but got %v", err)
+	}
+}
+
+func TestIdentRunes(t *testing.T) {
+	dash := WithIdentRunes(func(ch rune, i int) bool {
+		return ch == '_' || unicode.IsLetter(ch) || (i > 0 && (ch == '-' || unicode.IsDigit(ch)))
+	})
+	defs, err := ParseTagWithOptions("my-rule,max-len(value=10, mode=fast-path)", "t", dash)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 2 || defs[0].Name() != "my-rule" || defs[1].Name() != "max-len" {
+		t.Fatalf("names should be my-rule and max-len but got %v", defs)
+	}
+	if v, _ := defs[1].Attribute("mode"); v != "fast-path" {
+		t.Fatalf("mode should be fast-path but got %v", v)
+	}
+
+	defs, err = ParseTag("my_rule,max(value=-1)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if defs[0].Name() != "my_rule" {
+		t.Fatalf("name should be my_rule but got %s", defs[0].Name())
+	}
+	if v, _ := defs[1].Attribute("value"); v != int64(-1) {
+		t.Fatalf("value should be -1 but got %v", v)
+	}
+	if _, err := ParseTag("my-rule", "t"); err == nil {
+		t.Fatalf("my-rule should be an error by default")
+	}
+}
+
+func TestBoolAliases(t *testing.T) {
+	aliases := WithBoolAliases(map[string]bool{"yes": true, "no": false, "on": true, "off": false})
+	defs, err := ParseTagWithOptions("enabled=yes,cache(mode=off, level=high, list=[on,no])", "t", aliases)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("enabled"); v != true {
+		t.Fatalf("enabled should be true but got %#v", v)
+	}
+	if v, _ := defs[1].Attribute("mode"); v != false {
+		t.Fatalf("mode should be false but got %#v", v)
+	}
+	if v, _ := defs[1].Attribute("level"); v != "high" {
+		t.Fatalf("level should be a string but got %#v", v)
+	}
+	if v, _ := defs[1].ArrayAttribute("list"); len(v) != 2 || v[0] != true || v[1] != false {
+		t.Fatalf("list should be [true false] but got %#v", v)
+	}
+
+	defs, err = ParseTag("enabled=yes", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("enabled"); v != "yes" {
+		t.Fatalf("enabled should be a string by default but got %#v", v)
+	}
+}
+
+func TestDoubleQuotedStrings(t *testing.T) {
+	defs, err := ParseTag(`msg="don't",alt='he said "hi"',list=["a\tb", 'c', "\x41\""],esc="a\\b"`, "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for i, expected := range []interface{}{"don't", `he said "hi"`, nil, `a\b`} {
+		if expected == nil {
+			continue
+		}
+		if v, _ := defs[i].Attribute(defs[i].Name()); v != expected {
+			t.Fatalf("%s should be %q but got %#v", defs[i].Name(), expected, v)
+		}
+	}
+	if v, _ := defs[2].ArrayAttribute("list"); len(v) != 3 || v[0] != "a\tb" || v[1] != "c" || v[2] != `A"` {
+		t.Fatalf("unexpected list: %#v", v)
+	}
+
+	for _, tag := range []string{`msg="abc`, `msg='abc`, "msg=\"ab\nc\""} {
+		_, err := ParseTag(tag, "t")
+		if err == nil || !strings.HasPrefix(err.Error(), "unterminated string") {
+			t.Fatalf("%q should be an unterminated string error but got %v", tag, err)
+		}
+	}
+}
+
+type StructAll struct {
+	Name  string `validate:"required,max=10" json:"name,omitempty" db:"column(name=user_name)"` // nolint
+	Age   int    `validate:"min=0" json:"age"`                                                  // nolint
+	Email string `db:"column(name=mail)"`                                                       // nolint
+	Bad   string `broken:"abc=("`                                                               // nolint
+	Tags
+}
+
+type Tags struct {
+	Tag string `validate:"required"` // nolint
+}
+
+func TestParseStructAll(t *testing.T) {
+	result, err := ParseStructAll(&StructAll{}, "validate", "json", "db", "missing")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(result) != 4 || len(result["missing"]) != 0 {
+		t.Fatalf("result should have 4 tags but got %v", result)
+	}
+	if len(result["validate"]) != 3 || len(result["validate"]["Name"]) != 2 ||
+		result["validate"]["Tag"][0].Name() != "required" {
+		t.Fatalf("unexpected validate result: %v", result["validate"])
+	}
+	if defs := result["json"]["Name"]; len(defs) != 2 || defs[0].Name() != "name" || defs[1].Name() != "omitempty" {
+		t.Fatalf("unexpected json result: %v", result["json"])
+	}
+	if v, _ := result["db"]["Email"][0].Attribute("name"); v != "mail" {
+		t.Fatalf("unexpected db result: %v", result["db"])
+	}
+
+	_, err = ParseStructAll(&StructAll{})
+	if err == nil || !strings.HasPrefix(err.Error(), "broken: ") {
+		t.Fatalf("error should report the tag name but got %v", err)
+	}
+	var perr ParseError
+	if !errors.As(err, &perr) || perr.Source() != "StructAll.Bad" {
+		t.Fatalf("error should report the field name but got %v", err)
+	}
+}
+
+type StructAllTags struct {
+	Name string `validate:"required" json:"name" doc:"label=\"a name\""` // nolint
+}
+
+func TestParseStructAllTags(t *testing.T) {
+	result, err := ParseStructAll(StructAllTags{})
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(result) != 3 || result["validate"] == nil || result["json"] == nil || result["doc"] == nil {
+		t.Fatalf("all tags should be parsed but got %v", result)
+	}
+	if v, _ := result["doc"]["Name"][0].Attribute("label"); v != "a name" {
+		t.Fatalf("unexpected doc result: %v", result["doc"])
+	}
+}
+
+type StructDocs struct {
+	Name  string `validate:"required,max=10" doc:"a user name"` // nolint
+	Age   int    `validate:"min=0"`                             // nolint
+	Email string `doc:"an e-mail address"`                      // nolint
+	Other string // nolint
+}
+
+func TestParseStructWithDocs(t *testing.T) {
+	result, err := ParseStructWithDocs(&StructDocs{}, "validate", "doc")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(result) != 3 {
+		t.Fatalf("3 fields should be parsed but got %v", result)
+	}
+	if doc := result["Name"]; doc.Description != "a user name" || len(doc.Definitions) != 2 {
+		t.Fatalf("unexpected Name: %v", doc)
+	}
+	if doc := result["Age"]; doc.Description != "" || len(doc.Definitions) != 1 {
+		t.Fatalf("unexpected Age: %v", doc)
+	}
+	if doc := result["Email"]; doc.Description != "an e-mail address" || doc.Definitions != nil {
+		t.Fatalf("unexpected Email: %v", doc)
+	}
+}
+
+func TestMACLiterals(t *testing.T) {
+	defs, err := ParseTagWithOptions("device(mac=00:1A:2B:3C:4D:5E, port=8080)", "t", WithMACLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	v, _ := defs[0].Attribute("mac")
+	if mac, ok := v.(net.HardwareAddr); !ok || mac.String() != "00:1a:2b:3c:4d:5e" {
+		t.Fatalf("mac should be 00:1a:2b:3c:4d:5e but got %#v", v)
+	}
+	if v, _ := defs[0].Attribute("port"); v != int64(8080) {
+		t.Fatalf("port should be 8080 but got %#v", v)
+	}
+	s, err := Marshal(defs)
+	if err != nil || s != "device(mac=00:1a:2b:3c:4d:5e,port=8080)" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	for _, tag := range []string{"mac=00:1A:2B:3C:4D", "mac=00:1A:2B:3C:4D:5G", "mac=00:1A:2B:3C:4D:5E:6F",
+		"mac=00:1A::3C:4D:5E"} {
+		_, err := ParseTagWithOptions(tag, "t", WithMACLiterals())
+		perr, ok := err.(ParseError)
+		if !ok || !strings.HasPrefix(perr.Error(), "invalid MAC address") || perr.Line() != 1 || perr.Column() != 5 {
+			t.Fatalf("%s should be an error at 1:5 but got %v", tag, err)
+		}
+	}
+}
+
+func TestObjectLiterals(t *testing.T) {
+	defs, err := ParseTag("http(headers={content_type='application/json', retries=3, "+
+		"codes=[200, 201], auth={user=admin}}, list=[{a=1}, {}], empty={})", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	v, _ := defs[0].Attribute("headers")
+	headers, ok := v.(map[string]interface{})
+	if !ok || len(headers) != 4 || headers["content_type"] != "application/json" || headers["retries"] != int64(3) {
+		t.Fatalf("unexpected headers: %#v", v)
+	}
+	if codes, ok := headers["codes"].([]interface{}); !ok || len(codes) != 2 || codes[1] != int64(201) {
+		t.Fatalf("unexpected codes: %#v", headers["codes"])
+	}
+	if auth, ok := headers["auth"].(map[string]interface{}); !ok || auth["user"] != "admin" {
+		t.Fatalf("unexpected auth: %#v", headers["auth"])
+	}
+	list, _ := defs[0].ArrayAttribute("list")
+	if len(list) != 2 || list[0].(map[string]interface{})["a"] != int64(1) || len(list[1].(map[string]interface{})) != 0 {
+		t.Fatalf("unexpected list: %#v", list)
+	}
+	if v, _ := defs[0].Attribute("empty"); v == nil || len(v.(map[string]interface{})) != 0 {
+		t.Fatalf("empty should be an empty map but got %#v", v)
+	}
+	s, err := Marshal(defs)
+	expected := "http(empty={},headers={auth={user='admin'},codes=[200,201],content_type='application/json',retries=3}," +
+		"list=[{a=1},{}])"
+	if err != nil || s != expected {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{"h={a 1}", "= expected but got 1"},
+		{"h={1=2}", "invalid key: 1"},
+		{"h={a=1", "} or , expected but got "},
+		{"h={a=1;b=2}", "} or , expected but got ;"},
+	} {
+		_, err := ParseTag(c.tag, "t")
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Fatalf("%s should be %q error but got %v", c.tag, c.expected, err)
+		}
+	}
+}
+
+func TestWhitespaces(t *testing.T) {
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{"a , b", "a,b"},
+		{" a ,b ", "a,b"},
+		{"max = 10", "max=10"},
+		{"length ( min = 1 , max=2 )", "length(max=2,min=1)"},
+		{"in(v=[ 1 , 2 ])", "in(v=[1,2])"},
+		{"o(v={ k = 1 })", "o(v={k=1})"},
+	} {
+		defs, err := ParseTag(c.tag, "t")
+		if err != nil {
+			t.Fatalf("%s: parse failed: %s", c.tag, err.Error())
+		}
+		if s, err := Marshal(defs); err != nil || s != c.expected {
+			t.Fatalf("%s should be parsed as %s but got %s, %v", c.tag, c.expected, s, err)
+		}
+	}
+}
+
+func TestParseTagStrict(t *testing.T) {
+	defs, err := ParseTag("required min=1", "t")
+	if err != nil || len(defs) != 1 {
+		t.Fatalf("lenient parsing should drop a token but got %v, %v", defs, err)
+	}
+
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{"required min=1", ", expected but got min (1:10 [t])"},
+		{"required)", ", expected but got ) (1:9 [t])"},
+		{"max=10 foo", ", expected but got foo (1:8 [t])"},
+		{"length(min=1) x", ", expected but got x (1:15 [t])"},
+		{"max=10)", ", expected but got ) (1:7 [t])"},
+	} {
+		_, err := ParseTagStrict(c.tag, "t")
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("%s should be %q error but got %v", c.tag, c.expected, err)
+		}
+	}
+
+	defs, err = ParseTagStrict("required , max=10,length(min=1),", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 || defs[0].Name() != "required" || !IsFlag(defs[0]) {
+		t.Fatalf("unexpected definitions: %v", defs)
+	}
+}
+
+func TestParseTagSimple(t *testing.T) {
+	for _, tag := range []string{"required", "max=10", "min=-5", "min=007", "_x1=0",
+		"max=99999999999999999999", "max=10,min=1", "max=-", "1x", "max= 1", "max=1.5", "", "日本"} {
+		fast, ferr := ParseTag(tag, "t")
+		general, gerr := ParseTagWithOptions(tag, "t", WithSeparator(','))
+		if (ferr == nil) != (gerr == nil) {
+			t.Fatalf("%q: errors should be same but got %v and %v", tag, ferr, gerr)
+		}
+		if ferr == nil {
+			assertDefinitionsEqual(t, fast, general)
+		}
+	}
+	for tag, expected := range map[string]float64{"required": 2, "max=10": 3} {
+		allocs := testing.AllocsPerRun(100, func() { _, _ = ParseTag(tag, "t") })
+		if allocs > expected {
+			t.Fatalf("%s: should allocate at most %v times but got %v", tag, expected, allocs)
+		}
+	}
+}
+
+func BenchmarkParseTagFlag(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseTag("required", "t")
+	}
+}
+
+func BenchmarkParseTagInt(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseTag("max=10", "t")
+	}
+}
+
+func BenchmarkParseTagGeneral(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseTag("required,length(min=1, max=10)", "t")
+	}
+}
+
+func TestNoDuplicates(t *testing.T) {
+	defs, err := ParseTag("required,required,length(min=1, min=2)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[2].Attribute("min"); len(defs) != 3 || v != int64(2) {
+		t.Fatalf("the last attribute should win but got %v", defs)
+	}
+
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{"length(min=1, min=2)", "duplicated attribute: min (1:15 [t])"},
+		{"required,max=1,required", "duplicated definition: required (1:16 [t])"},
+		{"max=1,max(max=2)", "duplicated definition: max (1:7 [t])"},
+	} {
+		_, err := ParseTagWithOptions(c.tag, "t", WithNoDuplicates())
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("%s should be %q error but got %v", c.tag, c.expected, err)
+		}
+		_, err = ParseTagStrict(c.tag, "t")
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("%s should be %q error in strict mode but got %v", c.tag, c.expected, err)
+		}
+	}
+	if _, err := ParseTagWithOptions("f(a, a)", "t", WithNoDuplicates(), WithFlagArgs()); err == nil {
+		t.Fatalf("duplicated flags should be an error")
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	defs, err := ParseTag("n(hex=0xFF, oct=0o644, bin=0b1010, dec=010, neg=-0x10, "+
+		"sci=1e6, small=2.5e-3, negsci=-1e3, upper=0XfF)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for name, expected := range map[string]interface{}{
+		"hex":    int64(255),
+		"oct":    int64(0644),
+		"bin":    int64(10),
+		"dec":    int64(10),
+		"neg":    int64(-16),
+		"sci":    float64(1000000),
+		"small":  0.0025,
+		"negsci": float64(-1000),
+		"upper":  int64(255),
+	} {
+		if v, _ := defs[0].Attribute(name); v != expected {
+			t.Fatalf("%s should be %#v but got %#v", name, expected, v)
+		}
+	}
+
+	defs, err = ParseTagWithOptions("mask=0x10*2+0b1", "t", WithArithmetic())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("mask"); v != int64(33) {
+		t.Fatalf("mask should be 33 but got %#v", v)
+	}
+	if _, err := ParseTag("n=0xFFFFFFFFFFFFFFFFF", "t"); err == nil {
+		t.Fatalf("an overflowed value should be an error")
+	}
+}
+
+func TestBase64Literals(t *testing.T) {
+	defs, err := ParseTagWithOptions("key(data=b64:SGVsbG8=, empty=b64:, list=[b64:AQI=])", "t", WithBase64Literals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("data"); string(v.([]byte)) != "Hello" {
+		t.Fatalf("data should be Hello but got %#v", v)
+	}
+	if v, _ := defs[0].Attribute("empty"); v == nil || len(v.([]byte)) != 0 {
+		t.Fatalf("empty should be an empty []byte but got %#v", v)
+	}
+	if v, _ := defs[0].ArrayAttribute("list"); len(v) != 1 || string(v[0].([]byte)) != "\x01\x02" {
+		t.Fatalf("unexpected list: %#v", v)
+	}
+	s, err := Marshal(defs)
+	if err != nil || s != "key(data=b64:SGVsbG8=,empty=b64:,list=[b64:AQI=])" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	_, err = ParseTagWithOptions("key(data=b64:SGVsbG8)", "t", WithBase64Literals())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "invalid base64") || perr.Column() != 10 {
+		t.Fatalf("invalid base64 should be an error at 1:10 but got %v", err)
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	defs, err := ParseTagWithOptions("msg(tmpl='Hello {{.Name}}', plain='Hello')", "t", WithTemplateLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	v, _ := defs[0].Attribute("tmpl")
+	tmpl, ok := v.(*template.Template)
+	if !ok {
+		t.Fatalf("tmpl should be a template but got %#v", v)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, map[string]string{"Name": "gopher"}); err != nil || buf.String() != "Hello gopher" {
+		t.Fatalf("template should be executed but got %s, %v", buf.String(), err)
+	}
+	if v, _ := defs[0].Attribute("plain"); v != "Hello" {
+		t.Fatalf("plain should be a string but got %#v", v)
+	}
+	s, err := Marshal(defs)
+	if err != nil || s != "msg(plain='Hello',tmpl='Hello {{.Name}}')" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	_, err = ParseTagWithOptions("msg(tmpl='Hello {{.Name')", "t", WithTemplateLiterals())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "invalid template") || perr.Column() != 10 {
+		t.Fatalf("a syntax error should be an error at 1:10 but got %v", err)
+	}
+}
+
+func TestQuotedNames(t *testing.T) {
+	defs, err := ParseTagWithOptions(`'true'(x=1), "null"=true, 'max length'('min value'=1, v=false), f(null=null)`, "t",
+		WithQuotedNames())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 4 || defs[0].Name() != "true" || defs[1].Name() != "null" || defs[2].Name() != "max length" {
+		t.Fatalf("unexpected definitions: %v", defs)
+	}
+	if v, _ := defs[0].Attribute("x"); v != int64(1) {
+		t.Fatalf("x should be 1 but got %#v", v)
+	}
+	if v, _ := defs[1].Attribute("null"); v != true {
+		t.Fatalf("null should be true but got %#v", v)
+	}
+	if v, _ := defs[2].Attribute("min value"); v != int64(1) {
+		t.Fatalf("min value should be 1 but got %#v", v)
+	}
+	if v, _ := defs[2].Attribute("v"); v != false {
+		t.Fatalf("v should be false but got %#v", v)
+	}
+	if v, ok := defs[3].Attribute("null"); !ok || v != nil {
+		t.Fatalf("null should be nil but got %#v", v)
+	}
+
+	for _, tag := range []string{"''(x=1)", "'abc(x=1)", "f(''=1)"} {
+		if _, err := ParseTagWithOptions(tag, "t", WithQuotedNames()); err == nil {
+			t.Fatalf("%s should be an error", tag)
+		}
+	}
+}
+
+func TestParseTagFunc(t *testing.T) {
+	var names []string
+	err := ParseTagFunc("required,max=10,length(min=1, max=10)", "t", func(def Definition) error {
+		names = append(names, def.Name())
+		return nil
+	})
+	if err != nil || strings.Join(names, ",") != "required,max,length" {
+		t.Fatalf("all definitions should be visited but got %v, %v", names, err)
+	}
+
+	stop := errors.New("stop")
+	names = nil
+	err = ParseTagFunc("required,max=10,length(", "t", func(def Definition) error {
+		names = append(names, def.Name())
+		if def.Name() == "max" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(names) != 2 {
+		t.Fatalf("parsing should stop with the callback error but got %v, %v", names, err)
+	}
+
+	err = ParseTagFunc("required,max=(", "t", func(def Definition) error { return nil })
+	if _, ok := err.(ParseError); !ok {
+		t.Fatalf("error should be a ParseError but got %v", err)
+	}
+}
+
+func BenchmarkParseTagFunc(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = ParseTagFunc("required,length(min=1, max=10),max=10", "t", func(def Definition) error { return nil })
+	}
+}
+
+func BenchmarkParseTagSlice(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseTag("required,length(min=1, max=10),max=10", "t")
+	}
+}
+
+func TestParseStructOrdered(t *testing.T) {
+	expected := "ID,Created,By,Tagged,Name,Inner"
+	for i := 0; i < 10; i++ {
+		result, err := ParseStructOrdered(&StructEmbedded{}, "t1")
+		if err != nil {
+			t.Fatalf("parse failed: %s", err.Error())
+		}
+		names := make([]string, 0, len(result))
+		for _, f := range result {
+			names = append(names, f.Name)
+		}
+		if s := strings.Join(names, ","); s != expected {
+			t.Fatalf("fields should be %s but got %s", expected, s)
+		}
+		if result[0].Definitions[0].Name() != "required" {
+			t.Fatalf("ID should be required but got %v", result[0].Definitions)
+		}
+	}
+	if _, err := ParseStructOrdered(StructA{}, "t2"); err == nil {
+		t.Fatalf("an invalid tag should be an error")
+	}
+}
+
+func TestDashRanges(t *testing.T) {
+	defs, err := ParseTagWithOptions("age(range=18-65, neg=-5, n=5, list=[1-2, 3], f=1.5, d=2-3.5)", "t", WithDashRanges())
+	if err == nil {
+		t.Fatalf("2-3.5 should be an error but got %v", defs)
+	}
+	defs, err = ParseTagWithOptions("age(range=18-65, neg=-5, n=5, list=[1-2, 3], f=1.5)", "t", WithDashRanges())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for name, expected := range map[string]interface{}{
+		"range": Range{Lo: 18, Hi: 65},
+		"neg":   int64(-5),
+		"n":     int64(5),
+		"f":     1.5,
+	} {
+		if v, _ := defs[0].Attribute(name); v != expected {
+			t.Fatalf("%s should be %#v but got %#v", name, expected, v)
+		}
+	}
+	if v, _ := defs[0].ArrayAttribute("list"); len(v) != 2 || v[0] != (Range{Lo: 1, Hi: 2}) || v[1] != int64(3) {
+		t.Fatalf("unexpected list: %#v", v)
+	}
+	s, err := Marshal(defs)
+	if err != nil || s != "age(f=1.5,list=[1-2,3],n=5,neg=-5,range=18-65)" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	defs, err = ParseTagWithOptions("n=5 - 3,m=3-5", "t", WithDashRanges(), WithArithmetic())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("n"); v != int64(2) {
+		t.Fatalf("spaced 5 - 3 should not be a range but got %#v", v)
+	}
+	if v, _ := defs[1].Attribute("m"); v != (Range{Lo: 3, Hi: 5}) {
+		t.Fatalf("3-5 should be a range but got %#v", v)
+	}
+	if _, err := ParseTagWithOptions("n=5 - 3", "t", WithDashRanges()); err == nil {
+		t.Fatalf("spaced 5 - 3 should not be a range")
+	}
+
+	_, err = ParseTagWithOptions("age(range=65-18)", "t", WithDashRanges())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "invalid range: 65 is greater than 18") || perr.Column() != 11 {
+		t.Fatalf("65-18 should be an error at 1:11 but got %v", err)
+	}
+	if _, err := ParseTagWithOptions("age(range=5-5)", "t", WithDashRanges()); err != nil {
+		t.Fatalf("5-5 should be a range but got %v", err)
+	}
+}
+
+func TestDefinitionPosition(t *testing.T) {
+	defs, err := ParseTag("required,length(min=1, max= 10)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	def, ok := defs[1].(PositionedDefinition)
+	if !ok {
+		t.Fatalf("definitions should implement PositionedDefinition")
+	}
+	if pos := def.Position(); pos != (Position{Line: 1, Column: 10, Offset: 9}) {
+		t.Fatalf("length should be at 1:10 but got %v", pos)
+	}
+	if pos, ok := def.AttributePosition("min"); !ok || pos != (Position{Line: 1, Column: 21, Offset: 20}) {
+		t.Fatalf("min should be at 1:21 but got %v", pos)
+	}
+	if pos, ok := def.AttributePosition("max"); !ok || pos.Column != 29 {
+		t.Fatalf("max should be at 1:29 but got %v", pos)
+	}
+	if _, ok := def.AttributePosition("missing"); ok {
+		t.Fatalf("a missing attribute should not have a position")
+	}
+
+	defs, _ = ParseTag("a,\n  b=1", "t")
+	if pos := defs[1].(PositionedDefinition).Position(); pos.Line != 2 || pos.Column != 3 {
+		t.Fatalf("b should be at 2:3 but got %v", pos)
+	}
+
+	for _, tag := range []string{"required", "max=10"} {
+		fast, _ := ParseTag(tag, "t")
+		general, _ := ParseTagWithOptions(tag, "t", WithSeparator(','))
+		f, g := fast[0].(PositionedDefinition), general[0].(PositionedDefinition)
+		fp, _ := f.AttributePosition("max")
+		gp, _ := g.AttributePosition("max")
+		if f.Position() != g.Position() || fp != gp {
+			t.Fatalf("%s: positions should be same but got %v %v and %v %v", tag, f.Position(), fp, g.Position(), gp)
+		}
+	}
+}
+
+func TestStrictCommas(t *testing.T) {
+	defs, err := ParseTag("required length", "t")
+	if err != nil || len(defs) != 1 || defs[0].Name() != "length" {
+		t.Fatalf("lenient parsing should drop required but got %v, %v", defs, err)
+	}
+
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{"required length", ", expected between required and length (1:10 [t])"},
+		{"max=10 length(min=1)", ", expected between max and length (1:8 [t])"},
+		{"a,length(min=1)  b", ", expected between length and b (1:18 [t])"},
+	} {
+		_, err := ParseTagWithOptions(c.tag, "t", WithStrictCommas())
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("%s should be %q error but got %v", c.tag, c.expected, err)
+		}
+	}
+
+	defs, err = ParseTagWithOptions("required ,length(min=1) , max=1 ", "t", WithStrictCommas())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 || defs[0].Name() != "required" {
+		t.Fatalf("unexpected definitions: %v", defs)
+	}
+}
+
+func TestNestedTags(t *testing.T) {
+	defs, err := ParseTagWithOptions("nested<Name:required,length(min=1, max=10), Age:min=0, Note:pattern='a:b,c>'>,"+
+		"list(items=<Item:required>),required", "t", WithNestedTags())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("3 definitions should be parsed but got %v", defs)
+	}
+	v, _ := defs[0].Attribute("nested")
+	fields, ok := v.(map[string][]Definition)
+	if !ok || len(fields) != 3 {
+		t.Fatalf("nested should have 3 fields but got %#v", v)
+	}
+	if d := fields["Name"]; len(d) != 2 || d[0].Name() != "required" || d[1].Name() != "length" {
+		t.Fatalf("unexpected Name: %v", d)
+	}
+	if v, ok := fields["Age"][0].IntAttribute("min"); !ok || v != 0 {
+		t.Fatalf("unexpected Age: %v", fields["Age"])
+	}
+	if v, _ := fields["Note"][0].StringAttribute("pattern"); v != "a:b,c>" {
+		t.Fatalf("unexpected Note: %v", fields["Note"])
+	}
+	v, _ = defs[1].Attribute("items")
+	if items, ok := v.(map[string][]Definition); !ok || items["Item"][0].Name() != "required" {
+		t.Fatalf("unexpected items: %#v", v)
+	}
+	s, err := Marshal(defs[1:])
+	if err != nil || s != "list(items=<Item:required>),required" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	for _, c := range []struct {
+		tag      string
+		expected string
+	}{
+		{"nested<Name:required", "unterminated nested tags"},
+		{"nested<required>", "field name expected but got required"},
+		{"nested<Name:max=(>", "invalid value: '('"},
+	} {
+		_, err := ParseTagWithOptions(c.tag, "t", WithNestedTags())
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Fatalf("%s should be %q error but got %v", c.tag, c.expected, err)
+		}
+	}
+	_, err = ParseTagWithOptions("nested<Name:max=(>", "t", WithNestedTags())
+	if perr, ok := err.(ParseError); !ok || perr.Source() != "t.Name" {
+		t.Fatalf("error source should be t.Name but got %v", err)
+	}
+	_, err = ParseTagWithOptions("a,b,nested<Name:required, Age:min=(>", "t", WithNestedTags())
+	if err == nil || err.Error() != "invalid value: '(' (1:35 [t.Age])" {
+		t.Fatalf("error position should be in the tag but got %v", err)
+	}
+	_, err = ParseTagWithOptions("a,\nnested<Name:required,\nAge:min=(>", "t", WithNestedTags())
+	if err == nil || err.Error() != "invalid value: '(' (3:9 [t.Age])" {
+		t.Fatalf("error position should be in the tag but got %v", err)
+	}
+}
+
+func TestDeprecations(t *testing.T) {
+	p := NewParser(WithDeprecated(map[string]string{"len": "use length", "req": "use required"}))
+	defs, err := p.Parse("required,len(min=1),max=10,len=3", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 4 || defs[1].Name() != "len" {
+		t.Fatalf("deprecated definitions should be parsed but got %v", defs)
+	}
+	expected := []Deprecation{
+		{Name: "len", Replacement: "use length", Position: Position{Line: 1, Column: 10, Offset: 9}},
+		{Name: "len", Replacement: "use length", Position: Position{Line: 1, Column: 28, Offset: 27}},
+	}
+	if ds := p.Deprecations(); len(ds) != 2 || ds[0] != expected[0] || ds[1] != expected[1] {
+		t.Fatalf("deprecations should be %v but got %v", expected, ds)
+	}
+
+	if _, err := p.Parse("required,length(min=1)", "t"); err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if ds := p.Deprecations(); len(ds) != 0 {
+		t.Fatalf("no deprecations should be reported but got %v", ds)
+	}
+}
+
+func TestWhitespaceBeforeClosingBrackets(t *testing.T) {
+	expected, err := ParseTag("length(min=1, max=10),in=[a, b]", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	defs, err := ParseTag("length( min=1 , max=10 ) , in=[ a , b ]", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	assertDefinitionsEqual(t, expected, defs)
+}
+
+func TestComplexLiterals(t *testing.T) {
+	defs, err := ParseTagWithOptions("c(value=3+4i, imag=2i, neg=-1.5-2e1i, list=[1i, 2], n=-3, id=pi)", "t",
+		WithComplexLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for name, expected := range map[string]interface{}{
+		"value": complex(3, 4),
+		"imag":  complex(0, 2),
+		"neg":   complex(-1.5, -20),
+		"n":     int64(-3),
+		"id":    "pi",
+	} {
+		if v, _ := defs[0].Attribute(name); v != expected {
+			t.Fatalf("%s should be %#v but got %#v", name, expected, v)
+		}
+	}
+	if v, _ := defs[0].ArrayAttribute("list"); len(v) != 2 || v[0] != complex(0, 1) || v[1] != int64(2) {
+		t.Fatalf("unexpected list: %#v", v)
+	}
+	s, err := Marshal(defs[:1])
+	if err != nil || s != "c(id='pi',imag=0+2i,list=[0+1i,2],n=-3,neg=-1.5-20i,value=3+4i)" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	_, err = ParseTagWithOptions("c(value=3+i)", "t", WithComplexLiterals())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "invalid complex number: 3+i") || perr.Column() != 9 {
+		t.Fatalf("3+i should be an error at 1:9 but got %v", err)
+	}
+}
+
+func TestArrayDedup(t *testing.T) {
+	defs, err := ParseTagWithOptions("in(values=[a, b, 'a', b]), ints=[1, 2, 1, 3, 2], mixed=[1, 1.0, '1', 1, [1], [1]]",
+		"t", WithArrayDedup())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	names := []string{"values", "ints", "mixed"}
+	expected := []string{"[a b]", "[1 2 3]", "[1 1 1 [1]]"}
+	for i, def := range defs {
+		v, _ := def.ArrayAttribute(names[i])
+		if s := fmt.Sprint(v); s != expected[i] {
+			t.Fatalf("%s should be %s but got %s", names[i], expected[i], s)
+		}
+	}
+	mixed, _ := defs[2].ArrayAttribute("mixed")
+	if mixed[0] != int64(1) || mixed[1] != float64(1) || mixed[2] != "1" {
+		t.Fatalf("mixed types should not be merged: %#v", mixed)
+	}
+
+	defs, _ = ParseTag("in=[a, a]", "t")
+	if v, _ := defs[0].ArrayAttribute("in"); len(v) != 2 {
+		t.Fatalf("arrays should not be deduplicated by default: %v", v)
+	}
+}
+
+func TestConstants(t *testing.T) {
+	defs, err := ParseTagWithOptions("max=@LIMIT, const(LIMIT=10, NAME='x'), default=@NAME, in=[@LIMIT, 20]", "t",
+		WithConstants())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 {
+		t.Fatalf("const definitions should not be returned: %v", defs)
+	}
+	if v, _ := defs[0].Attribute("max"); v != int64(10) {
+		t.Fatalf("max should be 10 but got %v", v)
+	}
+	if v, _ := defs[1].Attribute("default"); v != "x" {
+		t.Fatalf("default should be x but got %v", v)
+	}
+	if v, _ := defs[2].ArrayAttribute("in"); len(v) != 2 || v[0] != int64(10) {
+		t.Fatalf("in should be [10 20] but got %v", v)
+	}
+
+	calls := 0
+	defs, err = ParseTagWithOptions("a=1,c=@X,b=-,const(X=1)", "t", WithConstants(),
+		WithRecover(func(ParseError) bool {
+			calls++
+			return true
+		}))
+	if err != nil || len(defs) != 2 || calls != 1 {
+		t.Fatalf("recover callback should be called once but called %d times: %v, %v", calls, defs, err)
+	}
+	if v, _ := defs[1].Attribute("c"); v != int64(1) {
+		t.Fatalf("c should be 1 but got %v", v)
+	}
+
+	_, err = ParseTagWithOptions("const(LIMIT=10), max=@LIMT", "t", WithConstants())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "undefined constant: LIMT") || perr.Column() != 22 {
+		t.Fatalf("undefined constant should be an error at 1:22 but got %v", err)
+	}
+}
+
+func TestStringMaxLen(t *testing.T) {
+	opts := []ParserOption{WithStringMaxLen("name", 5), WithStringMaxLen("title", 2)}
+	defs, err := ParseTagWithOptions("name='héllo', field(title=ab, size=123456), other='too long'", "t", opts...)
+	if err != nil {
+		t.Fatalf("values at the limit should be accepted: %s", err.Error())
+	}
+	if v, _ := defs[0].StringAttribute("name"); v != "héllo" {
+		t.Fatalf("name should be héllo but got %v", v)
+	}
+
+	_, err = ParseTagWithOptions("required, field(size=1, title='abc')", "t", opts...)
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "'title' must be at most 2 characters") || perr.Column() != 31 {
+		t.Fatalf("overlong value should be an error at 1:31 but got %v", err)
+	}
+}
+
+func TestLeadingSigil(t *testing.T) {
+	for _, value := range []string{"@required,length(min=1)", " @required,length(min=1)", "required,length(min=1)"} {
+		defs, err := ParseTagWithOptions(value, "t", WithLeadingSigil('@'))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %s", value, err.Error())
+		}
+		if len(defs) != 2 || defs[0].Name() != "required" || defs[1].Name() != "length" {
+			t.Fatalf("%s: unexpected definitions: %v", value, defs)
+		}
+	}
+	_, err := ParseTagWithOptions("required,@length(min=1)", "t", WithLeadingSigil('@'))
+	if err == nil {
+		t.Fatal("sigils except a leading one should be an error")
+	}
+	_, err = ParseTag("@required", "t")
+	if err == nil {
+		t.Fatal("sigils should be an error by default")
+	}
+}
+
+func TestRateLiterals(t *testing.T) {
+	defs, err := ParseTagWithOptions("limit(up=10MB/s, down=1GiB/m, burst=512KiB/100ms, size=10)", "t",
+		WithRateLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	for name, expected := range map[string]interface{}{
+		"up":    Rate{Bytes: 10 * 1000 * 1000, Per: time.Second},
+		"down":  Rate{Bytes: 1 << 30, Per: time.Minute},
+		"burst": Rate{Bytes: 512 << 10, Per: 100 * time.Millisecond},
+		"size":  int64(10),
+	} {
+		if v, _ := defs[0].Attribute(name); v != expected {
+			t.Fatalf("%s should be %v but got %#v", name, expected, v)
+		}
+	}
+	s, err := Marshal(defs)
+	if err != nil || s != "limit(burst=512KiB/100ms,down=1GiB/m,size=10,up=10MB/s)" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	_, err = ParseTagWithOptions("limit(up=10MB/)", "t", WithRateLiterals())
+	perr, ok := err.(ParseError)
+	if !ok || !strings.HasPrefix(perr.Error(), "invalid rate: 10MB/") || perr.Column() != 10 {
+		t.Fatalf("10MB/ should be an error at 1:10 but got %v", err)
+	}
+}
+
+func TestUUIDLiterals(t *testing.T) {
+	defs, err := ParseTagWithOptions("id(value=550E8400-e29b-41d4-a716-446655440000, hex=deadbeef, name=abc)", "t",
+		WithUUIDLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	expected := UUID{0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4,
+		0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00}
+	if v, _ := defs[0].Attribute("value"); v != expected {
+		t.Fatalf("value should be %v but got %#v", expected, v)
+	}
+	if v, _ := defs[0].Attribute("hex"); v != "deadbeef" {
+		t.Fatalf("hex should be a string but got %#v", v)
+	}
+	s, err := Marshal(defs)
+	if err != nil || s != "id(hex='deadbeef',name='abc',value=550e8400-e29b-41d4-a716-446655440000)" {
+		t.Fatalf("unexpected marshal result: %s, %v", s, err)
+	}
+
+	for _, value := range []string{
+		"id(value=550e8400-e29b-41d4-a716-44665544000)",
+		"id(value=550e8400-e29b-41d4-a716-44665544000g)",
+		"id(value=550e8400-e29b41d4-a716-4466554400000)",
+	} {
+		_, err = ParseTagWithOptions(value, "t", WithUUIDLiterals())
+		perr, ok := err.(ParseError)
+		if !ok || !strings.HasPrefix(perr.Error(), "invalid UUID") || perr.Column() != 10 {
+			t.Fatalf("%s should be an error at 1:10 but got %v", value, err)
+		}
+	}
+}
+
+func TestSkipUnknown(t *testing.T) {
+	p := NewParser(WithSkipUnknown())
+	defs, err := p.Parse("required, @ , length(min=1), @foo(x=1), max=3", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 3 || defs[0].Name() != "required" || defs[1].Name() != "length" || defs[2].Name() != "max" {
+		t.Fatalf("unexpected definitions: %v", defs)
+	}
+	skipped := p.Skipped()
+	if len(skipped) != 2 {
+		t.Fatalf("2 spans should be skipped but got %v", skipped)
+	}
+	if skipped[0].Text != "@" || skipped[0].Position.Column != 11 {
+		t.Fatalf("unexpected skipped span: %#v", skipped[0])
+	}
+	if skipped[1].Text != "@foo(x=1)" || skipped[1].Position.Column != 30 {
+		t.Fatalf("unexpected skipped span: %#v", skipped[1])
+	}
+
+	if _, err := p.Parse("required", "t"); err != nil || len(p.Skipped()) != 0 {
+		t.Fatalf("skipped spans should be reset: %v, %v", err, p.Skipped())
+	}
+	if _, err := NewParser().Parse("required, @, max=3", "t"); err == nil {
+		t.Fatal("unknown tokens should be an error by default")
+	}
+}
@@ -0,0 +1,67 @@
+package stagparser
+
+// SourceMap maps byte offsets in a tag value to parsed definitions and
+// attributes.
+type SourceMap struct {
+	entries []SourceMapEntry
+	pending []SourceMapEntry
+}
+
+// SourceMapEntry is a span of a definition or an attribute in a tag value.
+type SourceMapEntry struct {
+	// Start is a byte offset where the span starts
+	Start int
+	// End is a byte offset where the span ends(exclusive)
+	End int
+	// Definition is a definition that contains the span
+	Definition Definition
+	// Attribute is a name of an attribute, empty if the span is a whole definition
+	Attribute string
+}
+
+// Entries returns all entries in source order.
+func (m SourceMap) Entries() []SourceMapEntry {
+	return m.entries
+}
+
+// Lookup returns the innermost entry containing a given byte offset.
+func (m SourceMap) Lookup(offset int) (SourceMapEntry, bool) {
+	found := false
+	result := SourceMapEntry{}
+	for _, e := range m.entries {
+		if e.Start <= offset && offset < e.End && (!found || e.End-e.Start <= result.End-result.Start) {
+			result = e
+			found = true
+		}
+	}
+	return result, found
+}
+
+func (m *SourceMap) addAttribute(name string, start, end int) {
+	m.pending = append(m.pending, SourceMapEntry{Start: start, End: end, Attribute: name})
+}
+
+func (m *SourceMap) addDefinition(def Definition, start, end int) {
+	m.entries = append(m.entries, SourceMapEntry{Start: start, End: end, Definition: def})
+	if len(m.pending) == 0 && Len(def) == 1 {
+		// name with a single attribute: max=10
+		m.entries = append(m.entries, SourceMapEntry{Start: start, End: end, Definition: def, Attribute: def.Name()})
+	}
+	for _, e := range m.pending {
+		e.Definition = def
+		m.entries = append(m.entries, e)
+	}
+	m.pending = m.pending[:0]
+}
+
+// ParseTagMapped is like ParseTagWithOptions, but also returns a SourceMap
+// of the tag value.
+func ParseTagMapped(value string, name string, opts ...ParserOption) ([]Definition, SourceMap, error) {
+	p := newParser(name, opts...)
+	p.sourceMap = &SourceMap{}
+	defs, err := p.Parse(value)
+	if err != nil {
+		return nil, SourceMap{}, err
+	}
+	return defs, SourceMap{entries: p.sourceMap.entries}, nil
+}
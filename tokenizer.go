@@ -0,0 +1,135 @@
+package stagparser
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/scanner"
+)
+
+// TokenKind is a kind of a Token.
+type TokenKind int
+
+const (
+	// TokenEOF is the end of the input.
+	TokenEOF TokenKind = iota
+	// TokenIdent is an identifier.
+	TokenIdent
+	// TokenString is a string. Text is an unquoted value.
+	TokenString
+	// TokenInt is an integer.
+	TokenInt
+	// TokenFloat is a float.
+	TokenFloat
+	// TokenPunct is a punctuation like =, (, ), [, ] and separators.
+	TokenPunct
+	// TokenComment is a comment including its delimiters.
+	TokenComment
+)
+
+// Token is a token produced by a Tokenizer.
+type Token struct {
+	Kind     TokenKind
+	Text     string
+	Position Position
+}
+
+// Tokenizer produces tokens for the parser.
+type Tokenizer interface {
+	// Next returns the next token. Next returns a token of TokenEOF at the
+	// end of the input
+	Next() (Token, error)
+}
+
+type scannerTokenizer struct {
+	p *parser
+	// strings makes quoted strings TokenStrings instead of punctuations
+	strings bool
+}
+
+// NewScannerTokenizer returns a Tokenizer based on text/scanner that
+// produces tokens of the default grammar.
+func NewScannerTokenizer(input string) Tokenizer {
+	p := newParser("")
+	p.input = input
+	p.s.Init(strings.NewReader(input))
+	p.s.Mode &^= scanner.SkipComments
+	return &scannerTokenizer{p: p, strings: true}
+}
+
+func (t *scannerTokenizer) Next() (Token, error) {
+	if ch := t.p.skipWhitespace(); t.strings && (ch == '\'' || ch == '"') {
+		pos := t.p.s.Pos()
+		str, err := t.p.parseString(t.p.s.Next())
+		// the parser reads the position of the token from the scanner
+		t.p.s.Position = pos
+		return Token{Kind: TokenString, Text: str, Position: newPosition(pos)}, err
+	}
+	kind := TokenPunct
+	switch t.p.s.Scan() {
+	case scanner.EOF:
+		kind = TokenEOF
+	case scanner.Ident:
+		kind = TokenIdent
+	case scanner.Int:
+		kind = TokenInt
+	case scanner.Float:
+		kind = TokenFloat
+	case scanner.Comment:
+		kind = TokenComment
+	}
+	return Token{Kind: kind, Text: t.p.s.TokenText(), Position: newPosition(t.p.s.Position)}, nil
+}
+
+// tokenSpan is a token rendered at offset of the input.
+type tokenSpan struct {
+	offset int
+	pos    Position
+}
+
+// renderTokens renders tokens of t as a tag of the default syntax, so
+// tokens are parsed by the same grammar as characters. Tokens are joined by
+// a whitespace unless they are adjacent in the original input.
+func (p *parser) renderTokens(t Tokenizer) (string, error) {
+	var buf bytes.Buffer
+	p.spans = p.spans[:0]
+	end := 0
+	for {
+		tok, err := t.Next()
+		if err != nil {
+			return "", err
+		}
+		if tok.Kind == TokenEOF {
+			return buf.String(), nil
+		}
+		if buf.Len() != 0 && tok.Position.Offset != end {
+			buf.WriteByte(' ')
+		}
+		text := tok.Text
+		if tok.Kind == TokenString {
+			text = quoteString(text)
+		}
+		p.spans = append(p.spans, tokenSpan{offset: buf.Len(), pos: tok.Position})
+		buf.WriteString(text)
+		if tok.Kind == TokenComment && strings.HasPrefix(text, "//") {
+			buf.WriteByte('\n')
+		}
+		end = tok.Position.Offset + len(text)
+	}
+}
+
+// position converts pos in the input into a Position. If the input is
+// rendered from tokens, position returns the position of the token at pos
+// in the original input.
+func (p *parser) position(pos scanner.Position) Position {
+	if len(p.spans) == 0 {
+		return newPosition(pos)
+	}
+	i := sort.Search(len(p.spans), func(i int) bool {
+		return p.spans[i].offset > pos.Offset
+	})
+	if i == 0 {
+		i = 1
+	}
+	return p.spans[i-1].pos
+}
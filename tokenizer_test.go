@@ -0,0 +1,146 @@
+package stagparser_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+// wordTokenizer tokenizes space separated words. 'NAME:VALUE' is a name and
+// an int value and ';' is a separator.
+type wordTokenizer struct {
+	tokens []Token
+}
+
+func newWordTokenizer(input string) Tokenizer {
+	t := &wordTokenizer{}
+	for i, word := range strings.Fields(input) {
+		pos := Position{Line: 1, Column: i + 1}
+		if name, value, ok := strings.Cut(word, ":"); ok {
+			t.tokens = append(t.tokens, Token{Kind: TokenIdent, Text: name, Position: pos},
+				Token{Kind: TokenPunct, Text: "=", Position: pos},
+				Token{Kind: TokenInt, Text: value, Position: pos})
+			continue
+		}
+		kind := TokenIdent
+		if word == ";" {
+			kind = TokenPunct
+		}
+		t.tokens = append(t.tokens, Token{Kind: kind, Text: word, Position: pos})
+	}
+	return t
+}
+
+func (t *wordTokenizer) Next() (Token, error) {
+	if len(t.tokens) == 0 {
+		return Token{Kind: TokenEOF}, nil
+	}
+	tok := t.tokens[0]
+	t.tokens = t.tokens[1:]
+	return tok, nil
+}
+
+func TestCustomTokenizer(t *testing.T) {
+	defs, err := ParseTagWithOptions("required ; max:10", "t", WithTokenizer(newWordTokenizer), WithSeparator(';'))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 2 || defs[0].Name() != "required" || !IsFlag(defs[0]) {
+		t.Fatalf("unexpected definitions: %v", defs)
+	}
+	if v, _ := defs[1].Attribute("max"); v != int64(10) {
+		t.Fatalf("max should be 10 but got %#v", v)
+	}
+
+	_, err = ParseTagWithOptions("required max:10", "t", WithTokenizer(newWordTokenizer), WithSeparator(';'),
+		WithStrict())
+	if err == nil || err.Error() != "; expected but got max (1:2 [t])" {
+		t.Fatalf("a missing separator should be an error but got %v", err)
+	}
+}
+
+func TestScannerTokenizer(t *testing.T) {
+	for _, tag := range []string{
+		"required,max=10,length(min=1, max=10)",
+		"in(v=[1, -2.5, 'a,b', \"c\", x, true, null]),f=-0x10,e()",
+		"o(v={k=1, l=[2, 'it\\'s']}) , a ,",
+	} {
+		expected, err := ParseTag(tag, "t")
+		if err != nil {
+			t.Fatalf("parse failed: %s", err.Error())
+		}
+		defs, err := ParseTagWithOptions(tag, "t", WithTokenizer(NewScannerTokenizer))
+		if err != nil {
+			t.Fatalf("parse failed: %s", err.Error())
+		}
+		assertDefinitionsEqual(t, expected, defs)
+	}
+	for _, tag := range []string{"max=", "length(min)", "in(v=[1 2])", "a(", "=1", "f=-x"} {
+		if _, err := ParseTagWithOptions(tag, "t", WithTokenizer(NewScannerTokenizer)); err == nil {
+			t.Fatalf("%s should be an error", tag)
+		}
+	}
+}
+
+func TestTokenizerOptions(t *testing.T) {
+	tokenizer := WithTokenizer(NewScannerTokenizer)
+	_, err := ParseTagWithOptions("length(min=1),length(max=2)", "t", tokenizer, WithNoDuplicates())
+	if err == nil || err.Error() != "duplicated definition: length (1:15 [t])" {
+		t.Fatalf("a duplicated definition should be an error but got %v", err)
+	}
+
+	defs, err := ParseTagWithOptions("length(min=1), max=3", "t", tokenizer,
+		WithDefaultAttributes(map[string]map[string]interface{}{"length": {"max": int64(10)}}))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("max"); v != int64(10) {
+		t.Fatalf("default attributes should be merged but got %v", v)
+	}
+	pos, ok := defs[1].(PositionedDefinition).AttributePosition("max")
+	if !ok || pos.Column != 20 || pos.Offset != 19 {
+		t.Fatalf("unexpected position of max: %v, %v", pos, ok)
+	}
+
+	p := NewParser(tokenizer, WithDeprecated(map[string]string{"len": "length"}))
+	if _, err := p.Parse("required,len(min=1)", "t"); err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if d := p.Deprecations(); len(d) != 1 || d[0].Name != "len" || d[0].Position.Column != 10 {
+		t.Fatalf("unexpected deprecations: %v", d)
+	}
+
+	var recovered []string
+	defs, err = ParseTagWithOptions("required,in(v=[1 2], x=1),max=3", "t", tokenizer,
+		WithRecover(func(err ParseError) bool {
+			recovered = append(recovered, err.Error())
+			return true
+		}))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if len(defs) != 2 || defs[1].Name() != "max" || len(recovered) != 1 {
+		t.Fatalf("unexpected definitions: %v, recovered: %v", defs, recovered)
+	}
+
+	// tokens are parsed by the default grammar, so options extending it work
+	defs, err = ParseTagWithOptions("/* d */ type(kind=email) required,c=#fff", "t", tokenizer,
+		WithDescriptionComments(), WithTrailingFlags(), WithColorLiterals())
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if v, _ := defs[0].Attribute("required"); v != true || defs[0].Description() != "d" {
+		t.Fatalf("unexpected definition: %v", defs[0])
+	}
+	if v, _ := defs[1].Attribute("c"); v != (Color{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+		t.Fatalf("c should be a color but got %#v", v)
+	}
+	_, err = ParseTagWithOptions("length(min=1),c=#ffg", "t", tokenizer, WithColorLiterals())
+	if err == nil || !strings.HasSuffix(err.Error(), "(1:17 [t])") {
+		t.Fatalf("an error should be reported at the token position but got %v", err)
+	}
+	if _, _, err := ParseTagMapped("required", "t", tokenizer); err == nil {
+		t.Fatal("source maps should be an error")
+	}
+}
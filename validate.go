@@ -0,0 +1,138 @@
+package stagparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflicts reports mutually exclusive definitions that co-occur in defs.
+// Each element of groups is a list of mutually exclusive definition names.
+// Conflicts returns a message per violated group like
+// "conflicting definitions: required, optional".
+func Conflicts(defs []Definition, groups [][]string) []string {
+	present := map[string]bool{}
+	for _, def := range defs {
+		present[def.Name()] = true
+	}
+	var result []string
+	for _, group := range groups {
+		names := []string{}
+		for _, name := range group {
+			if present[name] {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 1 {
+			result = append(result, "conflicting definitions: "+strings.Join(names, ", "))
+		}
+	}
+	return result
+}
+
+// CheckBalanced checks that brackets((), [] and {}) and quotes(' and ") in
+// a tag value are balanced without parsing definitions. CheckBalanced returns
+// a ParseError at the first mismatch or nil.
+func CheckBalanced(value string) error {
+	type open struct {
+		ch           rune
+		line, column int
+	}
+	var stack []open
+	var quote *open
+	escaped := false
+	line, column := 1, 0
+	for _, ch := range value {
+		column++
+		if ch == '\n' {
+			line, column = line+1, 0
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case quote != nil:
+			if ch == '\\' {
+				escaped = true
+			} else if ch == quote.ch {
+				quote = nil
+			}
+		case ch == '\'' || ch == '"':
+			quote = &open{ch, line, column}
+		case ch == '(' || ch == '[' || ch == '{':
+			stack = append(stack, open{ch, line, column})
+		case ch == ')' || ch == ']' || ch == '}':
+			if len(stack) == 0 {
+				return &parseError{message: fmt.Sprintf("unexpected %s", string(ch)), line: line, column: column}
+			}
+			last := stack[len(stack)-1]
+			if closing := rune(")]}"[strings.IndexRune("([{", last.ch)]); ch != closing {
+				return &parseError{message: fmt.Sprintf("%s expected but got %s", string(closing), string(ch)),
+					line: line, column: column}
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if quote != nil {
+		return &parseError{message: "unterminated string", line: quote.line, column: quote.column}
+	}
+	if len(stack) != 0 {
+		last := stack[len(stack)-1]
+		return &parseError{message: fmt.Sprintf("unclosed %s", string(last.ch)), line: last.line, column: last.column}
+	}
+	return nil
+}
+
+// Schema describes allowed definitions for Validate. map key is a definition
+// name and the value maps allowed attribute names to kinds. A definition
+// like max=10 has an attribute named max. KindOther allows any values and
+// KindFloat also allows integers.
+type Schema map[string]map[string]ValueKind
+
+// SchemaError is an error reported by Validate.
+type SchemaError struct {
+	// Definition is a name of the definition
+	Definition string
+	// Attribute is a name of the attribute, empty if the error is about
+	// the definition itself
+	Attribute string
+	// Message is a description of the error
+	Message string
+}
+
+// Error implements error.
+func (e *SchemaError) Error() string {
+	return e.Definition + ": " + e.Message
+}
+
+// Validate checks given definitions against the schema and returns an error
+// per violation: an unknown definition, an unknown attribute and an
+// attribute of a wrong kind. Attributes are checked in name order.
+func Validate(defs []Definition, schema Schema) []error {
+	var result []error
+	for _, def := range defs {
+		attrs, ok := schema[def.Name()]
+		if !ok {
+			result = append(result, &SchemaError{Definition: def.Name(), Message: "unknown definition"})
+			continue
+		}
+		values := def.Attributes()
+		for _, name := range sortedKeys(values) {
+			want, ok := attrs[name]
+			if !ok {
+				result = append(result, &SchemaError{Definition: def.Name(), Attribute: name,
+					Message: fmt.Sprintf("unknown attribute '%s'", name)})
+				continue
+			}
+			tv, _ := def.AttributeTyped(name)
+			got := tv.Kind
+			if got == KindIdent {
+				got = KindString
+			}
+			if want == KindOther || got == want || (want == KindFloat && got == KindInt) {
+				continue
+			}
+			result = append(result, &SchemaError{Definition: def.Name(), Attribute: name,
+				Message: fmt.Sprintf("attribute '%s' is %s, want %s", name, got, want)})
+		}
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package stagparser_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/yuin/stagparser"
+)
+
+func TestConflicts(t *testing.T) {
+	groups := [][]string{{"required", "optional"}, {"email", "url"}}
+	defs, err := ParseTag("optional,max=10,required", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	conflicts := Conflicts(defs, groups)
+	if len(conflicts) != 1 || conflicts[0] != "conflicting definitions: required, optional" {
+		t.Fatalf("required and optional should be conflicted but got %v", conflicts)
+	}
+
+	defs, _ = ParseTag("required,email", "t")
+	if conflicts := Conflicts(defs, groups); len(conflicts) != 0 {
+		t.Fatalf("no conflicts should be reported but got %v", conflicts)
+	}
+}
+
+func TestCheckBalanced(t *testing.T) {
+	for _, value := range []string{"", "required", "length(min=1, max=10),in(v=[1, [2]])", "v={a=[1]}",
+		"msg='(['", `msg="it's \"}\""`, `msg='\')'`} {
+		if err := CheckBalanced(value); err != nil {
+			t.Fatalf("%s should be balanced but got %v", value, err)
+		}
+	}
+	for _, c := range []struct {
+		value    string
+		expected string
+		line     int
+		column   int
+	}{
+		{"length(min=1", "unclosed (", 1, 7},
+		{"a),b", "unexpected )", 1, 2},
+		{"in(v=[1)", "] expected but got )", 1, 8},
+		{"a=[1],b={x=(1}", ") expected but got }", 1, 14},
+		{"a='abc", "unterminated string", 1, 3},
+		{"a=1,\nb=\"x", "unterminated string", 2, 3},
+		{"日本(a=[1)", "] expected but got )", 1, 8},
+	} {
+		err := CheckBalanced(c.value)
+		perr, ok := err.(ParseError)
+		if !ok || !strings.HasPrefix(perr.Error(), c.expected) || perr.Line() != c.line || perr.Column() != c.column {
+			t.Fatalf("%q should be %q error at %d:%d but got %v", c.value, c.expected, c.line, c.column, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := Schema{
+		"required": nil,
+		"max":      {"max": KindInt},
+		"length":   {"min": KindInt, "max": KindInt},
+		"ratio":    {"ratio": KindFloat},
+		"in":       {"values": KindArray, "label": KindString, "any": KindOther},
+	}
+	defs, err := ParseTag("required,max=10,length(min=1, max=10),ratio=1,in(values=[1], label=abc, any=1.5)", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	if errs := Validate(defs, schema); len(errs) != 0 {
+		t.Fatalf("definitions should be valid but got %v", errs)
+	}
+
+	defs, err = ParseTag("length(min='abc', foo=1),unknown,required(x=1),ratio='a',in(label=[1])", "t")
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+	errs := Validate(defs, schema)
+	expected := []SchemaError{
+		{"length", "foo", "unknown attribute 'foo'"},
+		{"length", "min", "attribute 'min' is string, want int"},
+		{"unknown", "", "unknown definition"},
+		{"required", "x", "unknown attribute 'x'"},
+		{"ratio", "ratio", "attribute 'ratio' is string, want float"},
+		{"in", "label", "attribute 'label' is array, want string"},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("%d errors expected but got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		serr, ok := err.(*SchemaError)
+		if !ok || *serr != expected[i] {
+			t.Fatalf("error %d should be %#v but got %#v", i, expected[i], err)
+		}
+	}
+	if errs[1].Error() != "length: attribute 'min' is string, want int" {
+		t.Fatalf("unexpected error message: %s", errs[1].Error())
+	}
+}
@@ -0,0 +1,193 @@
+package stagparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldRef is a reference to a struct field like $User.Address.Zip.
+type FieldRef struct {
+	// Path is a dot separated field path
+	Path []string
+}
+
+// String implements fmt.Stringer.
+func (r FieldRef) String() string {
+	return "$" + strings.Join(r.Path, ".")
+}
+
+// Color is a color like #ff0000.
+type Color struct {
+	R, G, B, A uint8
+}
+
+// String implements fmt.Stringer.
+func (c Color) String() string {
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// CompositeLit is a Go composite literal like {Name: "x", Age: 30}.
+type CompositeLit struct {
+	Fields map[string]interface{}
+}
+
+// SliceRef is a slice expression like all[1:3] and all[-2:].
+// Low and High are nil if omitted.
+type SliceRef struct {
+	Name string
+	Low  *int
+	High *int
+}
+
+// String implements fmt.Stringer.
+func (r SliceRef) String() string {
+	var low, high string
+	if r.Low != nil {
+		low = strconv.Itoa(*r.Low)
+	}
+	if r.High != nil {
+		high = strconv.Itoa(*r.High)
+	}
+	return r.Name + "[" + low + ":" + high + "]"
+}
+
+// Placeholder is an environment variable placeholder like ${PORT:-8080}.
+type Placeholder struct {
+	Name string
+	// Default is a value after :-
+	Default string
+	// HasDefault is true if the placeholder has a :- clause
+	HasDefault bool
+}
+
+// String implements fmt.Stringer.
+func (p Placeholder) String() string {
+	if p.HasDefault {
+		return "${" + p.Name + ":-" + p.Default + "}"
+	}
+	return "${" + p.Name + "}"
+}
+
+// Range is a range of integers like 18-65.
+type Range struct {
+	Lo, Hi int64
+}
+
+// String implements fmt.Stringer.
+func (r Range) String() string {
+	return strconv.FormatInt(r.Lo, 10) + "-" + strconv.FormatInt(r.Hi, 10)
+}
+
+// Rate is a transfer rate like 10MB/s.
+type Rate struct {
+	// Bytes is a number of bytes per Per
+	Bytes int64
+	// Per is a unit of time
+	Per time.Duration
+}
+
+var sizeUnits = []struct {
+	name string
+	size int64
+}{
+	{"TiB", 1 << 40}, {"TB", 1e12}, {"GiB", 1 << 30}, {"GB", 1e9},
+	{"MiB", 1 << 20}, {"MB", 1e6}, {"KiB", 1 << 10}, {"KB", 1e3}, {"B", 1},
+}
+
+// String implements fmt.Stringer.
+func (r Rate) String() string {
+	size := strconv.FormatInt(r.Bytes, 10) + "B"
+	for _, unit := range sizeUnits {
+		if r.Bytes != 0 && r.Bytes%unit.size == 0 {
+			size = strconv.FormatInt(r.Bytes/unit.size, 10) + unit.name
+			break
+		}
+	}
+	switch r.Per {
+	case time.Second:
+		return size + "/s"
+	case time.Minute:
+		return size + "/m"
+	case time.Hour:
+		return size + "/h"
+	}
+	return size + "/" + r.Per.String()
+}
+
+// UUID is a UUID like 550e8400-e29b-41d4-a716-446655440000.
+type UUID [16]byte
+
+// String implements fmt.Stringer.
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// ValueKind is a kind of an attribute value in the source.
+type ValueKind int
+
+const (
+	// KindOther is a kind of values not listed below like Color.
+	KindOther ValueKind = iota
+	// KindNull is a kind of null.
+	KindNull
+	// KindBool is a kind of true and false.
+	KindBool
+	// KindInt is a kind of integers.
+	KindInt
+	// KindFloat is a kind of floats.
+	KindFloat
+	// KindString is a kind of quoted strings.
+	KindString
+	// KindIdent is a kind of identifiers interpreted as strings.
+	KindIdent
+	// KindArray is a kind of arrays.
+	KindArray
+	// KindObject is a kind of object literals.
+	KindObject
+)
+
+var valueKindNames = [...]string{"other", "null", "bool", "int", "float", "string", "ident", "array", "object"}
+
+// String implements fmt.Stringer.
+func (k ValueKind) String() string {
+	if k < 0 || int(k) >= len(valueKindNames) {
+		return "other"
+	}
+	return valueKindNames[k]
+}
+
+// TypedValue is an attribute value with its source form.
+type TypedValue struct {
+	Kind  ValueKind
+	Value interface{}
+	// Raw is a source text of the value. Raw is empty if the source is
+	// not recorded
+	Raw string
+}
+
+// valueKind returns a kind of v. A string is KindIdent only if raw is
+// known and is not quoted.
+func valueKind(v interface{}, raw string) ValueKind {
+	switch v.(type) {
+	case nil:
+		return KindNull
+	case bool:
+		return KindBool
+	case int64:
+		return KindInt
+	case float64:
+		return KindFloat
+	case string:
+		if len(raw) != 0 && raw[0] != '\'' && raw[0] != '"' {
+			return KindIdent
+		}
+		return KindString
+	case []interface{}:
+		return KindArray
+	case map[string]interface{}:
+		return KindObject
+	}
+	return KindOther
+}
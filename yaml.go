@@ -0,0 +1,122 @@
+package stagparser
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarshalYAML serializes given definitions into a YAML sequence of mappings
+// that have 'name' and 'attributes' keys. In flow style, length(min=1, max=10)
+// is serialized as [{name: "length", attributes: {max: 10, min: 1}}].
+// Strings are always double-quoted, so they are not confused with numbers,
+// bools and null. Other values like colors are written as double-quoted
+// strings of their tag forms.
+func MarshalYAML(defs []Definition) ([]byte, error) {
+	var buf bytes.Buffer
+	if len(defs) == 0 {
+		buf.WriteString("[]\n")
+		return buf.Bytes(), nil
+	}
+	for _, def := range defs {
+		buf.WriteString("- name: ")
+		buf.WriteString(strconv.Quote(def.Name()))
+		buf.WriteString("\n  attributes:")
+		if err := writeYAMLValue(&buf, def.Attributes(), 2); err != nil {
+			return nil, fmt.Errorf("%s: %w", def.Name(), err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeYAMLValue writes a value that follows a key and a colon.
+func writeYAMLValue(buf *bytes.Buffer, value interface{}, indent int) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" {}\n")
+			return nil
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteString("\n")
+		for _, key := range keys {
+			buf.WriteString(strings.Repeat(" ", indent+2))
+			buf.WriteString(yamlKey(key))
+			buf.WriteString(":")
+			if err := writeYAMLValue(buf, v[key], indent+2); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" []\n")
+			return nil
+		}
+		buf.WriteString("\n")
+		for _, e := range v {
+			buf.WriteString(strings.Repeat(" ", indent+2))
+			buf.WriteString("-")
+			if err := writeYAMLValue(buf, e, indent+2); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	s, err := yamlScalar(value)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(" ")
+	buf.WriteString(s)
+	buf.WriteString("\n")
+	return nil
+}
+
+func yamlScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return strconv.Quote(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return ".inf", nil
+		case math.IsInf(v, -1):
+			return "-.inf", nil
+		case math.IsNaN(v):
+			return ".nan", nil
+		}
+		return marshalValue(v)
+	}
+	// tag forms may start with YAML indicators like '#' and '{'
+	s, err := marshalValue(value)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Quote(s), nil
+}
+
+var yamlReservedWords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, "~": true,
+}
+
+func yamlKey(key string) string {
+	if yamlReservedWords[strings.ToLower(key)] {
+		return strconv.Quote(key)
+	}
+	return key
+}